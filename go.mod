@@ -8,6 +8,5 @@ require (
 	github.com/go-gl/mathgl v1.2.0
 	github.com/veandco/go-sdl2 v0.4.40
 	golang.org/x/image v0.29.0
+	golang.org/x/text v0.27.0
 )
-
-require golang.org/x/text v0.27.0 // indirect
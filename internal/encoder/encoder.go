@@ -0,0 +1,133 @@
+package encoder
+
+import "strconv"
+
+const (
+	ESC = 0x1b
+	BEL = 0x07
+)
+
+// Omit leaves a parameter or sub-parameter empty, as in CSI ;5H.
+const Omit = -1
+
+// Param is a parameter followed by its ':' separated sub-parameters.
+type Param []int
+
+// P builds a Param.
+func P(values ...int) Param {
+	return Param(values)
+}
+
+// CSI is a control sequence: ESC [ prefix params intermediates final.
+type CSI struct {
+	// Prefix is the private marker, one of < = > ? or 0
+	Prefix        byte
+	Params        []Param
+	Intermediates string
+	Final         byte
+}
+
+func (c CSI) Bytes() []byte {
+	return c.Append(make([]byte, 0, 16))
+}
+
+func (c CSI) Append(b []byte) []byte {
+	b = append(b, ESC, '[')
+	if c.Prefix != 0 {
+		b = append(b, c.Prefix)
+	}
+	b = appendParams(b, c.Params)
+	b = append(b, c.Intermediates...)
+	return append(b, c.Final)
+}
+
+// Csi is a shorthand for a CSI sequence with plain numeric parameters.
+func Csi(final byte, params ...int) []byte {
+	return CSI{Params: plain(params), Final: final}.Bytes()
+}
+
+// OSC is an operating system command: ESC ] code ; args ST.
+type OSC struct {
+	Code int
+	Args []string
+	// Bell terminates with BEL instead of ST, to answer programs that used it
+	Bell bool
+}
+
+func (o OSC) Bytes() []byte {
+	return o.Append(make([]byte, 0, 32))
+}
+
+func (o OSC) Append(b []byte) []byte {
+	b = append(b, ESC, ']')
+	b = strconv.AppendInt(b, int64(o.Code), 10)
+	for _, arg := range o.Args {
+		b = append(b, ';')
+		b = append(b, arg...)
+	}
+	if o.Bell {
+		return append(b, BEL)
+	}
+	return append(b, ESC, '\\')
+}
+
+// DCS is a device control string: ESC P params intermediates final data ST.
+type DCS struct {
+	Prefix        byte
+	Params        []Param
+	Intermediates string
+	Final         byte
+	Data          string
+}
+
+func (d DCS) Bytes() []byte {
+	return d.Append(make([]byte, 0, 32))
+}
+
+func (d DCS) Append(b []byte) []byte {
+	b = append(b, ESC, 'P')
+	if d.Prefix != 0 {
+		b = append(b, d.Prefix)
+	}
+	b = appendParams(b, d.Params)
+	b = append(b, d.Intermediates...)
+	b = append(b, d.Final)
+	b = append(b, d.Data...)
+	return append(b, ESC, '\\')
+}
+
+// SS3 is a single shift 3 sequence, used by keypad and cursor keys in application mode.
+func SS3(final byte) []byte {
+	return []byte{ESC, 'O', final}
+}
+
+// Esc is an escape sequence with optional intermediates.
+func Esc(intermediates string, final byte) []byte {
+	b := append([]byte{ESC}, intermediates...)
+	return append(b, final)
+}
+
+func plain(values []int) []Param {
+	params := make([]Param, len(values))
+	for i, v := range values {
+		params[i] = P(v)
+	}
+	return params
+}
+
+func appendParams(b []byte, params []Param) []byte {
+	for i, p := range params {
+		if i > 0 {
+			b = append(b, ';')
+		}
+		for j, v := range p {
+			if j > 0 {
+				b = append(b, ':')
+			}
+			if v != Omit {
+				b = strconv.AppendInt(b, int64(v), 10)
+			}
+		}
+	}
+	return b
+}
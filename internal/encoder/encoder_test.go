@@ -0,0 +1,290 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/moozd/goofed/internal/parser"
+)
+
+// decoded describes what the parser made of the encoded bytes.
+type decoded struct {
+	calls []string
+	dcs   []byte
+}
+
+func (d *decoded) log(format string, args ...any) {
+	d.calls = append(d.calls, fmt.Sprintf(format, args...))
+}
+
+func (d *decoded) Print(text []rune) { d.log("print %q", string(text)) }
+func (d *decoded) Execute(c byte)    { d.log("execute %#x", c) }
+func (d *decoded) Put(c byte)        { d.dcs = append(d.dcs, c) }
+func (d *decoded) Unhook()           { d.log("dcs data %q", d.dcs) }
+func (d *decoded) EscDispatch(i []byte, f byte) {
+	d.log("esc %s%c", i, f)
+}
+func (d *decoded) CsiDispatch(p *parser.Params, i []byte, f byte) {
+	d.log("csi %s %s%c", p, i, f)
+}
+func (d *decoded) Hook(p *parser.Params, i []byte, f byte) {
+	d.dcs = d.dcs[:0]
+	d.log("dcs %s %s%c", p, i, f)
+}
+func (d *decoded) OscDispatch(payload []byte, bell, truncated bool) {
+	d.log("osc %s", payload)
+}
+func (d *decoded) SosPmApcDispatch(kind parser.StringKind, payload []byte, truncated bool) {
+	d.log("%v %s", kind, payload)
+}
+
+func decode(b []byte) []string {
+	d := &decoded{}
+	p := parser.NewSync(context.Background(), parser.WithPerformer(d))
+	p.Feed(b)
+	return d.calls
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  []byte
+		want []string
+	}{
+		{"csi", Csi('H', 3, 7), []string{"csi 3;7 H"}},
+		{"csi no params", Csi('A'), []string{"csi  A"}},
+		{"csi omitted", CSI{Params: []Param{P(Omit), P(5)}, Final: 'H'}.Bytes(), []string{"csi ;5 H"}},
+		{"csi subs", CSI{Params: []Param{P(38, 2, Omit, 1, 2, 3)}, Final: 'm'}.Bytes(), []string{"csi 38:2::1:2:3 m"}},
+		{"osc st", OSC{Code: 2, Args: []string{"title"}}.Bytes(), []string{"osc 2;title", "esc \\"}},
+		{"osc bel", OSC{Code: 0, Args: []string{"a;b"}, Bell: true}.Bytes(), []string{"osc 0;a;b"}},
+		{"dcs", DCS{Params: []Param{P(1)}, Intermediates: "$", Final: 'r', Data: "0m"}.Bytes(), []string{`dcs 1 $r`, `dcs data "0m"`, "esc \\"}},
+		{"ss3", SS3('P'), []string{"esc O", `print "P"`}},
+		{"esc", Esc("(", 'B'), []string{"esc (B"}},
+		{"cpr", CursorPositionReport(24, 80), []string{"csi 24;80 R"}},
+		{"decxcpr", PrivateCursorPositionReport(1, 2), []string{"csi 1;2 ?R"}},
+		{"status", StatusOK(), []string{"csi 0 n"}},
+		{"da1", PrimaryDA(62, 22), []string{"csi 62;22 ?c"}},
+		{"da2", SecondaryDA(1, 10, 0), []string{"csi 1;10;0 >c"}},
+		{"da3", TertiaryDA("00000000"), []string{"dcs  !|", `dcs data "00000000"`, "esc \\"}},
+		{"xtversion", Version("goofed(0.1)"), []string{"dcs  >|", `dcs data "goofed(0.1)"`, "esc \\"}},
+		{"decrpm", ModeReport(2004, true, ModeSet), []string{"csi 2004;1 ?$y"}},
+		{"rpm", ModeReport(4, false, ModeReset), []string{"csi 4;2 $y"}},
+		{"color", ColorReport(4, []string{"1"}, ColorSpec(0xffff, 0, 0x8080), false), []string{"osc 4;1;rgb:ffff/0000/8080", "esc \\"}},
+		{"key", KeySequence(KeyUp, 0, false), []string{"csi  A"}},
+		{"key mods", KeySequence(KeyLeft, ModShift|ModCtrl, true), []string{"csi 1;6 D"}},
+		{"key tilde", KeySequence(KeyF5, 0, false), []string{"csi 15 ~"}},
+		{"key tilde mods", KeySequence(KeyDelete, ModAlt, false), []string{"csi 3;3 ~"}},
+		{"focus", FocusIn(), []string{"csi  I"}},
+		{"paste", BracketedPaste([]byte("hi")), []string{"csi 200 ~", `print "hi"`, "csi 201 ~"}},
+		{"mouse sgr", MouseSGR(MouseEvent{Button: MouseRight, Mods: ModCtrl, Row: 300, Col: 2}), []string{"csi 18;2;300 <M"}},
+		{"mouse sgr release", MouseSGR(MouseEvent{Button: MouseLeft, Release: true, Row: 1, Col: 1}), []string{"csi 0;1;1 <m"}},
+		{"kitty flags", KittyFlagsReport(KittyDisambiguate | KittyAllKeys), []string{"csi 9 ?u"}},
+		{"mouse urxvt", MouseURXVT(MouseEvent{Button: MouseWheelUp, Row: 4, Col: 5}), []string{"csi 96;5;4 M"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decode(tt.seq)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q decoded to:\n%q\nwant:\n%q", tt.seq, got, tt.want)
+			}
+		})
+	}
+}
+
+// The control function registry must recognise the replies it would answer with.
+func TestRoundTrip_Identify(t *testing.T) {
+	d := &identified{}
+	p := parser.NewSync(context.Background(), parser.WithPerformer(d))
+	p.Feed(CursorPositionReport(3, 4))
+	p.Feed(Csi('H', 3, 4))
+	p.Feed(ModeReport(25, true, ModeSet))
+
+	want := []string{"CUP(3;4)"}
+	if !reflect.DeepEqual(d.functions, want) {
+		t.Errorf("got %v, want %v", d.functions, want)
+	}
+}
+
+type identified struct {
+	decoded
+	functions []string
+}
+
+func (d *identified) CsiDispatch(p *parser.Params, i []byte, f byte) {
+	fn := parser.IdentifyCsi(p, i, f)
+	if fn.ID != parser.FnUnknown {
+		d.functions = append(d.functions, fn.String())
+	}
+}
+
+func TestKeySequence(t *testing.T) {
+	tests := []struct {
+		key         Key
+		mods        Modifiers
+		application bool
+		want        string
+	}{
+		{KeyUp, 0, false, "\x1b[A"},
+		{KeyUp, 0, true, "\x1bOA"},
+		{KeyUp, ModCtrl, true, "\x1b[1;5A"},
+		{KeyHome, 0, true, "\x1bOH"},
+		{KeyF1, 0, false, "\x1bOP"},
+		{KeyF1, ModShift, false, "\x1b[1;2P"},
+		{KeyPageDown, 0, true, "\x1b[6~"},
+		{KeyF12, ModShift | ModAlt | ModCtrl | ModSuper, false, "\x1b[24;16~"},
+		{Key(-1), 0, false, ""},
+	}
+
+	for _, tt := range tests {
+		if got := string(KeySequence(tt.key, tt.mods, tt.application)); got != tt.want {
+			t.Errorf("KeySequence(%v, %v, %v) = %q, want %q", tt.key, tt.mods, tt.application, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	app := KeyOptions{CursorKeys: true, Keypad: true}
+	tests := []struct {
+		key  Key
+		mods Modifiers
+		opts KeyOptions
+		want string
+	}{
+		{KeyUp, 0, KeyOptions{}, "\x1b[A"},
+		{KeyUp, 0, app, "\x1bOA"},
+		{KeyEnter, 0, KeyOptions{}, "\r"},
+		{KeyEnter, ModAlt, KeyOptions{}, "\x1b\r"},
+		{KeyEnter, ModCtrl, KeyOptions{ModifyOtherKeys: 1}, "\x1b[27;5;13~"},
+		{KeyTab, 0, KeyOptions{}, "\t"},
+		{KeyTab, ModShift, KeyOptions{ModifyOtherKeys: 2}, "\x1b[Z"},
+		{KeyBackspace, 0, KeyOptions{}, "\x7f"},
+		{KeyBackspace, ModCtrl, KeyOptions{}, "\x08"},
+		{KeyEscape, 0, KeyOptions{}, "\x1b"},
+		{KeyEscape, ModAlt, KeyOptions{}, "\x1b\x1b"},
+		{KeyKP5, 0, KeyOptions{}, "5"},
+		{KeyKP5, 0, app, "\x1bOu"},
+		{KeyKPAdd, ModCtrl, app, "+"},
+		{KeyKPEnter, 0, KeyOptions{}, "\r"},
+		{KeyKPEnter, 0, app, "\x1bOM"},
+	}
+
+	for _, tt := range tests {
+		if got := string(EncodeKey(tt.key, tt.mods, tt.opts)); got != tt.want {
+			t.Errorf("EncodeKey(%v, %v, %+v) = %q, want %q", tt.key, tt.mods, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeRune(t *testing.T) {
+	tests := []struct {
+		r     rune
+		mods  Modifiers
+		level int
+		want  string
+	}{
+		{'a', 0, 0, "a"},
+		{'é', ModShift, 0, "é"},
+		{'a', ModCtrl, 0, "\x01"},
+		{'A', ModCtrl | ModShift, 0, "\x01"},
+		{'[', ModCtrl, 0, "\x1b"},
+		{' ', ModCtrl, 0, "\x00"},
+		{'?', ModCtrl, 0, "\x7f"},
+		{'a', ModAlt, 0, "\x1ba"},
+		{'a', ModCtrl | ModAlt, 0, "\x1b\x01"},
+		{'1', ModCtrl, 0, "1"},
+		{'1', ModCtrl, 1, "\x1b[27;5;49~"},
+		{'a', ModCtrl, 1, "\x01"},
+		{'a', ModCtrl, 2, "\x1b[27;5;97~"},
+		{'a', ModAlt, 2, "\x1b[27;3;97~"},
+		{'a', ModSuper, 2, "a"},
+	}
+
+	for _, tt := range tests {
+		got := string(EncodeRune(tt.r, tt.mods, KeyOptions{ModifyOtherKeys: tt.level}))
+		if got != tt.want {
+			t.Errorf("EncodeRune(%q, %v, level %d) = %q, want %q", tt.r, tt.mods, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestKittyKeySequence(t *testing.T) {
+	all := KittyAllFlags
+	tests := []struct {
+		key   KittyKey
+		flags KittyFlags
+		want  string
+		ok    bool
+	}{
+		{KittyKey{Key: KeyEscape, Event: KeyPress}, 0, "", false},
+		{KittyKey{Key: KeyEscape, Event: KeyPress}, KittyDisambiguate, "\x1b[27u", true},
+		{KittyKey{Code: 'a', Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Code: 'a', Shifted: 'A', Mods: ModShift, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Code: 'a', Mods: ModCtrl, Event: KeyPress}, KittyDisambiguate, "\x1b[97;5u", true},
+		{KittyKey{Code: 'a', Mods: ModCapsLock, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Key: KeyEnter, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Key: KeyEnter, Mods: ModShift, Event: KeyPress}, KittyDisambiguate, "\x1b[13;2u", true},
+		{KittyKey{Key: KeyKP1, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Key: KeyKPAdd, Mods: ModNumLock, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Key: KeyKP1, Mods: ModCtrl, Event: KeyPress}, KittyDisambiguate, "\x1b[57400;5u", true},
+		{KittyKey{Key: KeyKPEnter, Event: KeyPress}, KittyDisambiguate, "\x1b[57414u", true},
+		{KittyKey{Key: KeyKP1, Event: KeyPress}, KittyAllKeys, "\x1b[57400u", true},
+		{KittyKey{Key: KeyUp, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Key: KeyUp, Event: KeyRelease}, KittyDisambiguate, "", true},
+		{KittyKey{Key: KeyUp, Event: KeyPress}, KittyEventTypes, "\x1b[A", true},
+		{KittyKey{Key: KeyUp, Event: KeyRepeat}, KittyEventTypes, "\x1b[1;1:2A", true},
+		{KittyKey{Key: KeyF5, Mods: ModAlt, Event: KeyRelease}, KittyEventTypes, "\x1b[15;3:3~", true},
+		{KittyKey{Key: KeyF3, Event: KeyPress}, KittyEventTypes, "\x1b[13~", true},
+		{KittyKey{Key: KeyLeftCtrl, Mods: ModCtrl, Event: KeyPress}, KittyDisambiguate, "", false},
+		{KittyKey{Key: KeyLeftCtrl, Mods: ModCtrl, Event: KeyPress}, KittyAllKeys, "\x1b[57442;5u", true},
+		{KittyKey{Code: 'a', Event: KeyPress, Text: "a"}, KittyAllKeys, "\x1b[97u", true},
+		{KittyKey{Code: 'a', Shifted: 'A', Mods: ModShift, Event: KeyPress}, KittyAllKeys | KittyAlternateKeys, "\x1b[97:65;2u", true},
+		{KittyKey{Code: 'a', Shifted: 'A', Mods: ModShift, Event: KeyPress, Text: "A"}, all, "\x1b[97:65;2;65u", true},
+		{KittyKey{Code: 'a', Event: KeyRelease, Text: "a"}, all, "\x1b[97;1:3u", true},
+		{KittyKey{Key: KeyEnter, Event: KeyPress, Text: "\r"}, all, "\x1b[13u", true},
+	}
+
+	for _, tt := range tests {
+		seq, ok := KittyKeySequence(tt.key, tt.flags)
+		if string(seq) != tt.want || ok != tt.ok {
+			t.Errorf("KittyKeySequence(%+v, %d) = %q, %v, want %q, %v", tt.key, tt.flags, seq, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBracketedPaste_StripsEndMarker(t *testing.T) {
+	got := string(BracketedPaste([]byte("a\x1b[20\x1b[201~1~b")))
+	want := "\x1b[200~ab\x1b[201~"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMouseX10(t *testing.T) {
+	got := MouseX10(MouseEvent{Button: MouseLeft, Mods: ModShift, Motion: true, Row: 1, Col: 10})
+	want := []byte{0x1b, '[', 'M', 32 + 36, 32 + 10, 32 + 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := MouseX10(MouseEvent{Row: 1, Col: 224}); got != nil {
+		t.Errorf("out of range position encoded as %q", got)
+	}
+	if got := MouseX10(MouseEvent{Button: MouseMiddle, Release: true, Row: 1, Col: 1}); got[3] != 32+3 {
+		t.Errorf("release encoded as %d, want %d", got[3], 32+3)
+	}
+}
+
+func TestMouseUTF8(t *testing.T) {
+	got := string(MouseUTF8(MouseEvent{Button: MouseLeft, Row: 2, Col: 300}))
+	want := "\x1b[M " + string(rune(32+300)) + string(rune(32+2))
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := MouseUTF8(MouseEvent{Row: 1, Col: 2016}); got != nil {
+		t.Errorf("out of range position encoded as %q", got)
+	}
+}
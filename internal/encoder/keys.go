@@ -0,0 +1,300 @@
+package encoder
+
+import "bytes"
+
+// Modifiers are the held modifier keys, the bits follow the kitty keyboard
+// protocol, whose first four agree with xterm.
+type Modifiers uint8
+
+const (
+	ModShift Modifiers = 1 << iota
+	ModAlt
+	ModCtrl
+	ModSuper
+	ModHyper
+	ModMeta
+	ModCapsLock
+	ModNumLock
+)
+
+// Param is the modifier parameter of xterm and kitty sequences, 1 when none are held.
+func (m Modifiers) Param() int {
+	return int(m) + 1
+}
+
+type Key int
+
+const (
+	KeyUp Key = iota
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEscape
+	KeyKP0
+	KeyKP1
+	KeyKP2
+	KeyKP3
+	KeyKP4
+	KeyKP5
+	KeyKP6
+	KeyKP7
+	KeyKP8
+	KeyKP9
+	KeyKPDecimal
+	KeyKPDivide
+	KeyKPMultiply
+	KeyKPSubtract
+	KeyKPAdd
+	KeyKPEqual
+	KeyKPEnter
+	KeyLeftShift
+	KeyLeftCtrl
+	KeyLeftAlt
+	KeyLeftSuper
+	KeyRightShift
+	KeyRightCtrl
+	KeyRightAlt
+	KeyRightSuper
+	KeyCapsLock
+	KeyNumLock
+)
+
+// IsKeypad tells whether key is on the numeric keypad.
+func (key Key) IsKeypad() bool {
+	return key >= KeyKP0 && key <= KeyKPEnter
+}
+
+// keySpec is how xterm sends a key: CSI number ~ when tilde is set, otherwise
+// CSI final, which becomes SS3 final in application mode or without modifiers
+// for F1-F4.
+type keySpec struct {
+	number int
+	final  byte
+	tilde  bool
+}
+
+var keySpecs = [...]keySpec{
+	KeyUp:       {final: 'A'},
+	KeyDown:     {final: 'B'},
+	KeyRight:    {final: 'C'},
+	KeyLeft:     {final: 'D'},
+	KeyHome:     {final: 'H'},
+	KeyEnd:      {final: 'F'},
+	KeyInsert:   {number: 2, tilde: true},
+	KeyDelete:   {number: 3, tilde: true},
+	KeyPageUp:   {number: 5, tilde: true},
+	KeyPageDown: {number: 6, tilde: true},
+	KeyF1:       {final: 'P'},
+	KeyF2:       {final: 'Q'},
+	KeyF3:       {final: 'R'},
+	KeyF4:       {final: 'S'},
+	KeyF5:       {number: 15, tilde: true},
+	KeyF6:       {number: 17, tilde: true},
+	KeyF7:       {number: 18, tilde: true},
+	KeyF8:       {number: 19, tilde: true},
+	KeyF9:       {number: 20, tilde: true},
+	KeyF10:      {number: 21, tilde: true},
+	KeyF11:      {number: 23, tilde: true},
+	KeyF12:      {number: 24, tilde: true},
+}
+
+// KeySequence encodes a special key the way xterm does. application is the
+// DECCKM cursor key mode, it only applies to the cursor, home and end keys.
+func KeySequence(key Key, mods Modifiers, application bool) []byte {
+	if key < 0 || int(key) >= len(keySpecs) {
+		return nil
+	}
+	spec := keySpecs[key]
+
+	if spec.tilde {
+		if mods == 0 {
+			return Csi('~', spec.number)
+		}
+		return Csi('~', spec.number, mods.Param())
+	}
+
+	if mods != 0 {
+		return Csi(spec.final, 1, mods.Param())
+	}
+	if application || (key >= KeyF1 && key <= KeyF4) {
+		return SS3(spec.final)
+	}
+	return Csi(spec.final)
+}
+
+// KeyOptions are the terminal modes that change what keys send.
+type KeyOptions struct {
+	// CursorKeys is DECCKM, the cursor keys send SS3 sequences
+	CursorKeys bool
+	// Keypad is DECKPAM, the keypad sends SS3 sequences
+	Keypad bool
+	// ModifyOtherKeys is the xterm modifyOtherKeys level, 0 to 2
+	ModifyOtherKeys int
+}
+
+// controlKeys are the keys that send a C0 control or DEL.
+var controlKeys = map[Key]byte{
+	KeyEnter:     '\r',
+	KeyTab:       '\t',
+	KeyBackspace: 0x7f,
+	KeyEscape:    ESC,
+	KeyKPEnter:   '\r',
+}
+
+// keypadKeys are what the keypad keys type in numeric mode and the SS3 final
+// they send in application mode.
+var keypadKeys = [...]struct {
+	char  rune
+	final byte
+}{
+	KeyKP0 - KeyKP0:        {'0', 'p'},
+	KeyKP1 - KeyKP0:        {'1', 'q'},
+	KeyKP2 - KeyKP0:        {'2', 'r'},
+	KeyKP3 - KeyKP0:        {'3', 's'},
+	KeyKP4 - KeyKP0:        {'4', 't'},
+	KeyKP5 - KeyKP0:        {'5', 'u'},
+	KeyKP6 - KeyKP0:        {'6', 'v'},
+	KeyKP7 - KeyKP0:        {'7', 'w'},
+	KeyKP8 - KeyKP0:        {'8', 'x'},
+	KeyKP9 - KeyKP0:        {'9', 'y'},
+	KeyKPDecimal - KeyKP0:  {'.', 'n'},
+	KeyKPDivide - KeyKP0:   {'/', 'o'},
+	KeyKPMultiply - KeyKP0: {'*', 'j'},
+	KeyKPSubtract - KeyKP0: {'-', 'm'},
+	KeyKPAdd - KeyKP0:      {'+', 'k'},
+	KeyKPEqual - KeyKP0:    {'=', 'X'},
+	KeyKPEnter - KeyKP0:    {'\r', 'M'},
+}
+
+// EncodeKey encodes a key that does not type text the way xterm does.
+func EncodeKey(key Key, mods Modifiers, opts KeyOptions) []byte {
+	if key.IsKeypad() {
+		k := keypadKeys[key-KeyKP0]
+		if opts.Keypad && mods == 0 {
+			return SS3(k.final)
+		}
+		if key != KeyKPEnter {
+			return EncodeRune(k.char, mods, opts)
+		}
+	}
+
+	c, ok := controlKeys[key]
+	if !ok {
+		return KeySequence(key, mods, opts.CursorKeys)
+	}
+	switch {
+	case key == KeyTab && mods == ModShift:
+		return Csi('Z')
+	case mods != 0 && opts.ModifyOtherKeys > 0:
+		return modifiedKey(rune(c), mods)
+	case key == KeyBackspace && mods&ModCtrl != 0:
+		c = 0x08
+	}
+	return withAlt([]byte{c}, mods)
+}
+
+// EncodeRune encodes a typed character with the modifiers held. Shift is
+// already part of r. Ctrl turns it into a C0 control, Alt prefixes ESC, and
+// modifyOtherKeys sends CSI 27 ; modifiers ; code ~ instead, at level 1 only
+// for the combinations that have no control of their own.
+func EncodeRune(r rune, mods Modifiers, opts KeyOptions) []byte {
+	if mods&(ModCtrl|ModAlt) == 0 {
+		return []byte(string(r))
+	}
+	if opts.ModifyOtherKeys >= 2 {
+		return modifiedKey(r, mods)
+	}
+
+	b := []byte(string(r))
+	if mods&ModCtrl != 0 {
+		c, ok := controlChar(r)
+		switch {
+		case ok:
+			b = []byte{c}
+		case opts.ModifyOtherKeys == 1:
+			return modifiedKey(r, mods)
+		}
+	}
+	return withAlt(b, mods)
+}
+
+// controlChar is the C0 control Ctrl turns r into, as in xterm.
+func controlChar(r rune) (byte, bool) {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return byte(r - 'a' + 1), true
+	case r >= '@' && r <= '_':
+		return byte(r - '@'), true
+	case r == ' ' || r == '2':
+		return 0, true
+	case r >= '3' && r <= '7':
+		return byte(r - '3' + ESC), true
+	case r == '8' || r == '?':
+		return 0x7f, true
+	case r == '/':
+		return 0x1f, true
+	}
+	return 0, false
+}
+
+func modifiedKey(r rune, mods Modifiers) []byte {
+	return Csi('~', 27, mods.Param(), int(r))
+}
+
+// withAlt prefixes ESC when Alt is held, xterm's metaSendsEscape.
+func withAlt(b []byte, mods Modifiers) []byte {
+	if mods&ModAlt == 0 {
+		return b
+	}
+	return append([]byte{ESC}, b...)
+}
+
+// FocusIn and FocusOut are reported when focus events, mode 1004, are enabled.
+func FocusIn() []byte {
+	return Csi('I')
+}
+
+func FocusOut() []byte {
+	return Csi('O')
+}
+
+// PasteStart and PasteEnd surround pasted text in bracketed paste mode, 2004.
+func PasteStart() []byte {
+	return Csi('~', 200)
+}
+
+func PasteEnd() []byte {
+	return Csi('~', 201)
+}
+
+// BracketedPaste wraps text in the paste markers. End markers are removed
+// from the text, so a paste can't end itself early and inject input.
+func BracketedPaste(text []byte) []byte {
+	end := PasteEnd()
+	for bytes.Contains(text, end) {
+		text = bytes.ReplaceAll(text, end, nil)
+	}
+	b := append(PasteStart(), text...)
+	return append(b, end...)
+}
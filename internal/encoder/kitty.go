@@ -0,0 +1,187 @@
+package encoder
+
+import "unicode"
+
+// KittyFlags are the progressive enhancements of the kitty keyboard protocol
+// a program asks for.
+type KittyFlags uint8
+
+const (
+	KittyDisambiguate KittyFlags = 1 << iota
+	KittyEventTypes
+	KittyAlternateKeys
+	KittyAllKeys
+	KittyAssociatedText
+
+	// KittyAllFlags are the flags goofed supports
+	KittyAllFlags = KittyDisambiguate | KittyEventTypes | KittyAlternateKeys | KittyAllKeys | KittyAssociatedText
+)
+
+// KeyEvent tells a press from a repeat and a release.
+type KeyEvent int
+
+const (
+	KeyPress KeyEvent = iota + 1
+	KeyRepeat
+	KeyRelease
+)
+
+// KittyKey is a key event for the kitty keyboard protocol. A key that types
+// text has its unshifted character in Code, any other key has Code 0 and is
+// told by Key.
+type KittyKey struct {
+	Key  Key
+	Code rune
+	// Shifted is Code with shift applied, 0 when shift is not held or unknown
+	Shifted rune
+	Mods    Modifiers
+	Event   KeyEvent
+	// Text is what the key typed, sent with KittyAssociatedText
+	Text string
+}
+
+// kittyKeys are the numbers and finals of the keys that do not type text,
+// those with final u are sent only by the kitty protocol.
+var kittyKeys = map[Key]struct {
+	number int
+	final  byte
+}{
+	KeyUp:         {1, 'A'},
+	KeyDown:       {1, 'B'},
+	KeyRight:      {1, 'C'},
+	KeyLeft:       {1, 'D'},
+	KeyHome:       {1, 'H'},
+	KeyEnd:        {1, 'F'},
+	KeyInsert:     {2, '~'},
+	KeyDelete:     {3, '~'},
+	KeyPageUp:     {5, '~'},
+	KeyPageDown:   {6, '~'},
+	KeyF1:         {1, 'P'},
+	KeyF2:         {1, 'Q'},
+	KeyF3:         {13, '~'},
+	KeyF4:         {1, 'S'},
+	KeyF5:         {15, '~'},
+	KeyF6:         {17, '~'},
+	KeyF7:         {18, '~'},
+	KeyF8:         {19, '~'},
+	KeyF9:         {20, '~'},
+	KeyF10:        {21, '~'},
+	KeyF11:        {23, '~'},
+	KeyF12:        {24, '~'},
+	KeyEnter:      {13, 'u'},
+	KeyTab:        {9, 'u'},
+	KeyBackspace:  {127, 'u'},
+	KeyEscape:     {27, 'u'},
+	KeyKP0:        {57399, 'u'},
+	KeyKP1:        {57400, 'u'},
+	KeyKP2:        {57401, 'u'},
+	KeyKP3:        {57402, 'u'},
+	KeyKP4:        {57403, 'u'},
+	KeyKP5:        {57404, 'u'},
+	KeyKP6:        {57405, 'u'},
+	KeyKP7:        {57406, 'u'},
+	KeyKP8:        {57407, 'u'},
+	KeyKP9:        {57408, 'u'},
+	KeyKPDecimal:  {57409, 'u'},
+	KeyKPDivide:   {57410, 'u'},
+	KeyKPMultiply: {57411, 'u'},
+	KeyKPSubtract: {57412, 'u'},
+	KeyKPAdd:      {57413, 'u'},
+	KeyKPEnter:    {57414, 'u'},
+	KeyKPEqual:    {57415, 'u'},
+	KeyCapsLock:   {57358, 'u'},
+	KeyNumLock:    {57360, 'u'},
+	KeyLeftShift:  {57441, 'u'},
+	KeyLeftCtrl:   {57442, 'u'},
+	KeyLeftAlt:    {57443, 'u'},
+	KeyLeftSuper:  {57444, 'u'},
+	KeyRightShift: {57447, 'u'},
+	KeyRightCtrl:  {57448, 'u'},
+	KeyRightAlt:   {57449, 'u'},
+	KeyRightSuper: {57450, 'u'},
+}
+
+// KittyKeySequence encodes a key event with the enhancements in flags. ok is
+// false when the event is sent the legacy way instead, as text or with
+// EncodeKey. A release the flags do not ask for encodes to nothing.
+func KittyKeySequence(k KittyKey, flags KittyFlags) (seq []byte, ok bool) {
+	if flags == 0 {
+		return nil, false
+	}
+	if !kittyEncodes(k, flags) {
+		return nil, k.Event == KeyRelease
+	}
+	if k.Event == KeyRelease && flags&KittyEventTypes == 0 {
+		return nil, true
+	}
+
+	number, final := int(k.Code), byte('u')
+	if k.Code == 0 {
+		spec, known := kittyKeys[k.Key]
+		if !known {
+			return nil, true
+		}
+		number, final = spec.number, spec.final
+	}
+
+	key := Param{number}
+	if flags&KittyAlternateKeys != 0 && k.Code != 0 && k.Shifted != 0 && k.Shifted != k.Code {
+		key = append(key, int(k.Shifted))
+	}
+
+	mods := Param{k.Mods.Param()}
+	if flags&KittyEventTypes != 0 && k.Event > KeyPress {
+		mods = append(mods, int(k.Event))
+	}
+
+	var text Param
+	if flags&KittyAssociatedText != 0 && k.Event != KeyRelease {
+		for _, r := range k.Text {
+			if unicode.IsPrint(r) {
+				text = append(text, int(r))
+			}
+		}
+	}
+
+	c := CSI{Final: final}
+	switch {
+	case len(text) > 0:
+		c.Params = []Param{key, mods, text}
+	case len(mods) > 1 || mods[0] > 1:
+		c.Params = []Param{key, mods}
+	case final == 'u' || final == '~':
+		c.Params = []Param{key}
+	}
+	return c.Bytes(), true
+}
+
+// kittyEncodes tells whether the flags move a key off its legacy encoding.
+func kittyEncodes(k KittyKey, flags KittyFlags) bool {
+	if flags&KittyAllKeys != 0 {
+		return true
+	}
+
+	disambiguate := flags&KittyDisambiguate != 0
+	mods := k.Mods &^ (ModCapsLock | ModNumLock)
+	switch {
+	case k.Code != 0, k.Key.IsKeypad() && k.Key != KeyKPEnter:
+		// text with shift alone is not ambiguous, the keypad keys that type
+		// text are text keys too
+		return disambiguate && mods&^ModShift != 0
+	case k.Key == KeyEnter || k.Key == KeyTab || k.Key == KeyBackspace:
+		// so that typing reset still works after a program left the protocol on
+		return disambiguate && mods != 0
+	case k.Key == KeyEscape, k.Key == KeyKPEnter:
+		return disambiguate
+	case k.Key >= KeyLeftShift:
+		// modifier keys are only reported with KittyAllKeys
+		return false
+	}
+	// the other keys have the same encoding in both, only event types differ
+	return flags&KittyEventTypes != 0
+}
+
+// KittyFlagsReport answers CSI ? u with the flags in effect.
+func KittyFlagsReport(flags KittyFlags) []byte {
+	return CSI{Prefix: '?', Params: plain([]int{int(flags)}), Final: 'u'}.Bytes()
+}
@@ -0,0 +1,100 @@
+package encoder
+
+import "unicode/utf8"
+
+// MouseButton is the button code of a mouse report, before modifiers and motion are added.
+type MouseButton int
+
+const (
+	MouseLeft MouseButton = iota
+	MouseMiddle
+	MouseRight
+	// MouseRelease is how the legacy encodings report any button release
+	MouseRelease
+	MouseWheelUp    MouseButton = 64
+	MouseWheelDown  MouseButton = 65
+	MouseWheelLeft  MouseButton = 66
+	MouseWheelRight MouseButton = 67
+	MouseButton8    MouseButton = 128
+	MouseButton9    MouseButton = 129
+)
+
+const (
+	mouseShiftFlag  = 4
+	mouseAltFlag    = 8
+	mouseCtrlFlag   = 16
+	mouseMotionFlag = 32
+	// the legacy encoding sends every number as a byte offset by 32
+	x10Offset = 32
+	x10Limit  = 255 - x10Offset
+	// mode 1005 sends them as UTF-8 characters, two bytes at most
+	utf8Limit = 0x7ff - x10Offset
+)
+
+// MouseEvent is a mouse report, Row and Col are 1 based cells.
+type MouseEvent struct {
+	Button  MouseButton
+	Mods    Modifiers
+	Motion  bool
+	Release bool
+	Row     int
+	Col     int
+}
+
+func (e MouseEvent) code(release bool) int {
+	code := int(e.Button)
+	if release {
+		code = int(MouseRelease)
+	}
+	if e.Motion {
+		code |= mouseMotionFlag
+	}
+	if e.Mods&ModShift != 0 {
+		code |= mouseShiftFlag
+	}
+	if e.Mods&ModAlt != 0 {
+		code |= mouseAltFlag
+	}
+	if e.Mods&ModCtrl != 0 {
+		code |= mouseCtrlFlag
+	}
+	return code
+}
+
+// MouseX10 encodes the legacy CSI M Cb Cx Cy report. Positions past 223 can't
+// be encoded and nothing is returned.
+func MouseX10(e MouseEvent) []byte {
+	if e.Row > x10Limit || e.Col > x10Limit {
+		return nil
+	}
+	return []byte{ESC, '[', 'M', byte(e.code(e.Release) + x10Offset), byte(e.Col + x10Offset), byte(e.Row + x10Offset)}
+}
+
+// MouseUTF8 encodes mode 1005, the legacy report with each number sent as a
+// UTF-8 character. Positions past 2015 can't be encoded and nothing is
+// returned.
+func MouseUTF8(e MouseEvent) []byte {
+	if e.Row > utf8Limit || e.Col > utf8Limit {
+		return nil
+	}
+	b := []byte{ESC, '[', 'M'}
+	for _, n := range []int{e.code(e.Release), e.Col, e.Row} {
+		b = utf8.AppendRune(b, rune(n+x10Offset))
+	}
+	return b
+}
+
+// MouseSGR encodes mode 1006, CSI < Cb ; Cx ; Cy M, with m for a release.
+// Mode 1016 sends the same report with Row and Col in pixels.
+func MouseSGR(e MouseEvent) []byte {
+	final := byte('M')
+	if e.Release {
+		final = 'm'
+	}
+	return CSI{Prefix: '<', Params: plain([]int{e.code(false), e.Col, e.Row}), Final: final}.Bytes()
+}
+
+// MouseURXVT encodes mode 1015, CSI Cb ; Cx ; Cy M.
+func MouseURXVT(e MouseEvent) []byte {
+	return Csi('M', e.code(e.Release)+x10Offset, e.Col, e.Row)
+}
@@ -0,0 +1,70 @@
+package encoder
+
+import "fmt"
+
+// CursorPositionReport answers DSR 6, row and col are 1 based.
+func CursorPositionReport(row, col int) []byte {
+	return Csi('R', row, col)
+}
+
+// PrivateCursorPositionReport answers DECXCPR, CSI ? 6 n.
+func PrivateCursorPositionReport(row, col int) []byte {
+	return CSI{Prefix: '?', Params: plain([]int{row, col}), Final: 'R'}.Bytes()
+}
+
+// StatusOK answers DSR 5, the terminal is ready.
+func StatusOK() []byte {
+	return Csi('n', 0)
+}
+
+// PrimaryDA answers DA1 with the conformance level followed by the
+// supported features, as in CSI ? 62 ; 22 c.
+func PrimaryDA(attrs ...int) []byte {
+	return CSI{Prefix: '?', Params: plain(attrs), Final: 'c'}.Bytes()
+}
+
+// SecondaryDA answers DA2 with the terminal type, firmware version and rom cartridge.
+func SecondaryDA(kind, version, rom int) []byte {
+	return CSI{Prefix: '>', Params: plain([]int{kind, version, rom}), Final: 'c'}.Bytes()
+}
+
+// TertiaryDA answers DA3 with the hex encoded unit id.
+func TertiaryDA(unit string) []byte {
+	return DCS{Intermediates: "!", Final: '|', Data: unit}.Bytes()
+}
+
+// Version answers XTVERSION, as in DCS > | goofed(1.0) ST.
+func Version(name string) []byte {
+	return DCS{Prefix: '>', Final: '|', Data: name}.Bytes()
+}
+
+// ModeState is the answer to DECRQM.
+type ModeState int
+
+const (
+	ModeNotRecognized ModeState = iota
+	ModeSet
+	ModeReset
+	ModePermanentlySet
+	ModePermanentlyReset
+)
+
+// ModeReport answers DECRQM, private is for DEC modes requested with CSI ? Ps $ p.
+func ModeReport(mode int, private bool, state ModeState) []byte {
+	c := CSI{Params: plain([]int{mode, int(state)}), Intermediates: "$", Final: 'y'}
+	if private {
+		c.Prefix = '?'
+	}
+	return c.Bytes()
+}
+
+// ColorSpec formats 16 bit channels the way XParseColor expects them, as in rgb:ffff/0000/0000.
+func ColorSpec(r, g, b uint16) string {
+	return fmt.Sprintf("rgb:%04x/%04x/%04x", r, g, b)
+}
+
+// ColorReport answers an OSC colour query, as in OSC 11 ; ? or OSC 4 ; 1 ; ?.
+// The reply echoes the query's code and leading arguments, and its terminator.
+func ColorReport(code int, args []string, spec string, bell bool) []byte {
+	return OSC{Code: code, Args: append(append([]string{}, args...), spec), Bell: bell}.Bytes()
+}
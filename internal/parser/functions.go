@@ -0,0 +1,394 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// FunctionID names a control function, so consumers can switch on it
+// instead of on final bytes and intermediates.
+type FunctionID uint16
+
+const (
+	FnUnknown FunctionID = iota
+
+	// ESC
+	FnDECSC
+	FnDECRC
+	FnDECKPAM
+	FnDECKPNM
+	FnIND
+	FnNEL
+	FnHTS
+	FnRI
+	FnSS2
+	FnSS3
+	FnST
+	FnRIS
+	FnLS2
+	FnLS3
+	FnLS1R
+	FnLS2R
+	FnLS3R
+	FnDECALN
+	FnSCS
+
+	// CSI
+	FnICH
+	FnCUU
+	FnCUD
+	FnCUF
+	FnCUB
+	FnCNL
+	FnCPL
+	FnCHA
+	FnCUP
+	FnCHT
+	FnED
+	FnDECSED
+	FnEL
+	FnDECSEL
+	FnIL
+	FnDL
+	FnDCH
+	FnSU
+	FnSD
+	FnECH
+	FnCBT
+	FnHPA
+	FnHPR
+	FnREP
+	FnDA1
+	FnDA2
+	FnDA3
+	FnVPA
+	FnVPR
+	FnHVP
+	FnTBC
+	FnSM
+	FnDECSET
+	FnRM
+	FnDECRST
+	FnSGR
+	FnXTMODKEYS
+	FnDSR
+	FnDECDSR
+	FnDECSTBM
+	FnXTRESTORE
+	FnSCOSC
+	FnXTSAVE
+	FnSCORC
+	FnKittyKeyboardPush
+	FnKittyKeyboardPop
+	FnKittyKeyboardQuery
+	FnKittyKeyboardSet
+	FnDECSCUSR
+	FnXTVERSION
+	FnDECRQM
+	FnDECRQMPrivate
+	FnDECSTR
+	FnXTWINOPS
+
+	// OSC
+	FnOscTitleAndIcon
+	FnOscIconName
+	FnOscTitle
+	FnOscSetColor
+	FnOscCwd
+	FnOscHyperlink
+	FnOscForeground
+	FnOscBackground
+	FnOscCursorColor
+	FnOscClipboard
+	FnOscResetColor
+	FnOscResetForeground
+	FnOscResetBackground
+	FnOscResetCursorColor
+	FnOscShellIntegration
+
+	// DCS
+	FnDECRQSS
+	FnXTGETTCAP
+	FnSixel
+)
+
+// spec describes a control function and the defaults of its arguments.
+type spec struct {
+	id   FunctionID
+	name string
+	// defaults of the positional arguments, the last one repeats. When a
+	// default is not 0, an explicit 0 means default too, like xterm does.
+	defaults []int
+}
+
+func (s *spec) def(i int) int {
+	if len(s.defaults) == 0 {
+		return 0
+	}
+	return s.defaults[min(i, len(s.defaults)-1)]
+}
+
+type seqKind uint8
+
+const (
+	seqEsc seqKind = iota
+	seqCsi
+	seqDcs
+)
+
+// key identifies an ESC, CSI or DCS sequence by its intermediates and final byte.
+type key struct {
+	kind          seqKind
+	intermediates [2]byte
+	final         byte
+}
+
+func newKey(kind seqKind, intermediates []byte, final byte) (key, bool) {
+	k := key{kind: kind, final: final}
+	if len(intermediates) > len(k.intermediates) {
+		return k, false
+	}
+	copy(k.intermediates[:], intermediates)
+	return k, true
+}
+
+var (
+	registry    = map[key]*spec{}
+	oscRegistry = map[int]*spec{}
+	names       = map[FunctionID]string{FnUnknown: "unknown"}
+)
+
+func register(kind seqKind, seq string, id FunctionID, name string, defaults ...int) {
+	s := &spec{id: id, name: name, defaults: defaults}
+	k, _ := newKey(kind, []byte(seq[:len(seq)-1]), seq[len(seq)-1])
+	registry[k] = s
+	names[id] = name
+}
+
+func registerOsc(code int, id FunctionID, name string) {
+	oscRegistry[code] = &spec{id: id, name: name}
+	names[id] = name
+}
+
+func init() {
+	register(seqEsc, "7", FnDECSC, "DECSC")
+	register(seqEsc, "8", FnDECRC, "DECRC")
+	register(seqEsc, "=", FnDECKPAM, "DECKPAM")
+	register(seqEsc, ">", FnDECKPNM, "DECKPNM")
+	register(seqEsc, "D", FnIND, "IND")
+	register(seqEsc, "E", FnNEL, "NEL")
+	register(seqEsc, "H", FnHTS, "HTS")
+	register(seqEsc, "M", FnRI, "RI")
+	register(seqEsc, "N", FnSS2, "SS2")
+	register(seqEsc, "O", FnSS3, "SS3")
+	register(seqEsc, "\\", FnST, "ST")
+	register(seqEsc, "c", FnRIS, "RIS")
+	register(seqEsc, "n", FnLS2, "LS2")
+	register(seqEsc, "o", FnLS3, "LS3")
+	register(seqEsc, "~", FnLS1R, "LS1R")
+	register(seqEsc, "}", FnLS2R, "LS2R")
+	register(seqEsc, "|", FnLS3R, "LS3R")
+	register(seqEsc, "#8", FnDECALN, "DECALN")
+	names[FnSCS] = "SCS"
+
+	register(seqCsi, "@", FnICH, "ICH", 1)
+	register(seqCsi, "A", FnCUU, "CUU", 1)
+	register(seqCsi, "B", FnCUD, "CUD", 1)
+	register(seqCsi, "C", FnCUF, "CUF", 1)
+	register(seqCsi, "D", FnCUB, "CUB", 1)
+	register(seqCsi, "E", FnCNL, "CNL", 1)
+	register(seqCsi, "F", FnCPL, "CPL", 1)
+	register(seqCsi, "G", FnCHA, "CHA", 1)
+	register(seqCsi, "H", FnCUP, "CUP", 1)
+	register(seqCsi, "I", FnCHT, "CHT", 1)
+	register(seqCsi, "J", FnED, "ED")
+	register(seqCsi, "?J", FnDECSED, "DECSED")
+	register(seqCsi, "K", FnEL, "EL")
+	register(seqCsi, "?K", FnDECSEL, "DECSEL")
+	register(seqCsi, "L", FnIL, "IL", 1)
+	register(seqCsi, "M", FnDL, "DL", 1)
+	register(seqCsi, "P", FnDCH, "DCH", 1)
+	register(seqCsi, "S", FnSU, "SU", 1)
+	register(seqCsi, "T", FnSD, "SD", 1)
+	register(seqCsi, "X", FnECH, "ECH", 1)
+	register(seqCsi, "Z", FnCBT, "CBT", 1)
+	register(seqCsi, "`", FnHPA, "HPA", 1)
+	register(seqCsi, "a", FnHPR, "HPR", 1)
+	register(seqCsi, "b", FnREP, "REP", 1)
+	register(seqCsi, "c", FnDA1, "DA1")
+	register(seqCsi, ">c", FnDA2, "DA2")
+	register(seqCsi, "=c", FnDA3, "DA3")
+	register(seqCsi, "d", FnVPA, "VPA", 1)
+	register(seqCsi, "e", FnVPR, "VPR", 1)
+	register(seqCsi, "f", FnHVP, "HVP", 1)
+	register(seqCsi, "g", FnTBC, "TBC")
+	register(seqCsi, "h", FnSM, "SM")
+	register(seqCsi, "?h", FnDECSET, "DECSET")
+	register(seqCsi, "l", FnRM, "RM")
+	register(seqCsi, "?l", FnDECRST, "DECRST")
+	register(seqCsi, "m", FnSGR, "SGR")
+	register(seqCsi, ">m", FnXTMODKEYS, "XTMODKEYS")
+	register(seqCsi, "n", FnDSR, "DSR")
+	register(seqCsi, "?n", FnDECDSR, "DECDSR")
+	register(seqCsi, "r", FnDECSTBM, "DECSTBM")
+	register(seqCsi, "?r", FnXTRESTORE, "XTRESTORE")
+	register(seqCsi, "s", FnSCOSC, "SCOSC")
+	register(seqCsi, "?s", FnXTSAVE, "XTSAVE")
+	register(seqCsi, "u", FnSCORC, "SCORC")
+	register(seqCsi, ">u", FnKittyKeyboardPush, "XTPUSHKEYBOARD")
+	register(seqCsi, "<u", FnKittyKeyboardPop, "XTPOPKEYBOARD", 1)
+	register(seqCsi, "?u", FnKittyKeyboardQuery, "XTQUERYKEYBOARD")
+	register(seqCsi, "=u", FnKittyKeyboardSet, "XTSETKEYBOARD", 0, 1)
+	register(seqCsi, " q", FnDECSCUSR, "DECSCUSR")
+	register(seqCsi, ">q", FnXTVERSION, "XTVERSION")
+	register(seqCsi, "$p", FnDECRQM, "DECRQM")
+	register(seqCsi, "?$p", FnDECRQMPrivate, "DECRQM")
+	register(seqCsi, "!p", FnDECSTR, "DECSTR")
+	register(seqCsi, "t", FnXTWINOPS, "XTWINOPS")
+
+	registerOsc(0, FnOscTitleAndIcon, "OSC 0")
+	registerOsc(1, FnOscIconName, "OSC 1")
+	registerOsc(2, FnOscTitle, "OSC 2")
+	registerOsc(4, FnOscSetColor, "OSC 4")
+	registerOsc(7, FnOscCwd, "OSC 7")
+	registerOsc(8, FnOscHyperlink, "OSC 8")
+	registerOsc(10, FnOscForeground, "OSC 10")
+	registerOsc(11, FnOscBackground, "OSC 11")
+	registerOsc(12, FnOscCursorColor, "OSC 12")
+	registerOsc(52, FnOscClipboard, "OSC 52")
+	registerOsc(104, FnOscResetColor, "OSC 104")
+	registerOsc(110, FnOscResetForeground, "OSC 110")
+	registerOsc(111, FnOscResetBackground, "OSC 111")
+	registerOsc(112, FnOscResetCursorColor, "OSC 112")
+	registerOsc(133, FnOscShellIntegration, "OSC 133")
+
+	register(seqDcs, "$q", FnDECRQSS, "DECRQSS")
+	register(seqDcs, "+q", FnXTGETTCAP, "XTGETTCAP")
+	register(seqDcs, "q", FnSixel, "SIXEL")
+}
+
+func (id FunctionID) String() string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Function is a dispatched sequence identified as a control function. It
+// points into the parser's buffers, so it is only valid during the dispatch.
+type Function struct {
+	ID            FunctionID
+	Params        *Params
+	Intermediates []byte
+	Final         byte
+	// Payload is the DCS body, or the OSC string after its number
+	Payload []byte
+	// Code is the OSC number, -1 when it is missing
+	Code int
+
+	spec *spec
+}
+
+var noParams = &Params{}
+
+// IdentifyCsi looks up a CSI dispatch, unknown sequences get FnUnknown.
+func IdentifyCsi(params *Params, intermediates []byte, final byte) Function {
+	return identify(seqCsi, params, intermediates, final)
+}
+
+// IdentifyEsc looks up an ESC dispatch, character set designations are all FnSCS.
+func IdentifyEsc(intermediates []byte, final byte) Function {
+	if len(intermediates) == 1 && strings.IndexByte("()*+-./", intermediates[0]) >= 0 {
+		return Function{ID: FnSCS, Params: noParams, Intermediates: intermediates, Final: final, Code: -1}
+	}
+	return identify(seqEsc, noParams, intermediates, final)
+}
+
+// IdentifyDcs looks up a DCS string by its header, payload is its body.
+func IdentifyDcs(params *Params, intermediates []byte, final byte, payload []byte) Function {
+	fn := identify(seqDcs, params, intermediates, final)
+	fn.Payload = payload
+	return fn
+}
+
+func identify(kind seqKind, params *Params, intermediates []byte, final byte) Function {
+	fn := Function{ID: FnUnknown, Params: params, Intermediates: intermediates, Final: final, Code: -1}
+
+	k, ok := newKey(kind, intermediates, final)
+	if !ok {
+		return fn
+	}
+	if s, ok := registry[k]; ok {
+		fn.ID, fn.spec = s.id, s
+	}
+	return fn
+}
+
+// IdentifyOsc looks up an OSC string by the number it starts with.
+func IdentifyOsc(payload []byte) Function {
+	fn := Function{ID: FnUnknown, Params: noParams, Code: -1}
+
+	code, rest, _ := bytes.Cut(payload, []byte{';'})
+	fn.Payload = rest
+
+	if len(code) == 0 {
+		return fn
+	}
+	n := 0
+	for _, c := range code {
+		if !isBetween(c, '0', '9') {
+			return fn
+		}
+		n = min(n*10+int(c-'0'), MaxParamValue)
+	}
+	fn.Code = n
+
+	if s, ok := oscRegistry[n]; ok {
+		fn.ID, fn.spec = s.id, s
+	}
+	return fn
+}
+
+func (f Function) Name() string {
+	return f.ID.String()
+}
+
+// Arg returns the i-th numeric argument with the function's default applied.
+func (f Function) Arg(i int) int {
+	def := 0
+	if f.spec != nil {
+		def = f.spec.def(i)
+	}
+
+	v := f.Params.Get(i, def)
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// Field returns the i-th ';' separated field of the payload.
+func (f Function) Field(i int) []byte {
+	rest := f.Payload
+	for ; i > 0; i-- {
+		_, after, found := bytes.Cut(rest, []byte{';'})
+		if !found {
+			return nil
+		}
+		rest = after
+	}
+
+	field, _, _ := bytes.Cut(rest, []byte{';'})
+	return field
+}
+
+func (f Function) String() string {
+	switch {
+	case f.Code >= 0:
+		return fmt.Sprintf("%s(%q)", f.Name(), f.Payload)
+	case f.ID == FnUnknown:
+		return fmt.Sprintf("unknown(%q %q %q)", f.Params.String(), f.Intermediates, f.Final)
+	}
+	return fmt.Sprintf("%s(%s)", f.Name(), f.Params.String())
+}
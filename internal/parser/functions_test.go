@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func identifyEvent(e ParserEvent) Function {
+	switch {
+	case e.Action() == ActionCsiDispatch:
+		return IdentifyCsi(e.Params(), e.Intermediates(), e.Final())
+	case e.Action() == ActionEscDispatch:
+		return IdentifyEsc(e.Intermediates(), e.Final())
+	case e.Kind() == KindOsc:
+		return IdentifyOsc(e.Payload())
+	case e.Kind() == KindDcs:
+		return IdentifyDcs(e.Params(), e.Intermediates(), e.Final(), e.Payload())
+	}
+	return Function{}
+}
+
+func TestIdentify(t *testing.T) {
+	cases := []struct {
+		input string
+		id    FunctionID
+		args  []int
+	}{
+		{"\x1b[H", FnCUP, []int{1, 1}},
+		{"\x1b[0;7H", FnCUP, []int{1, 7}},
+		{"\x1b[5A", FnCUU, []int{5}},
+		{"\x1b[J", FnED, []int{0}},
+		{"\x1b[2J", FnED, []int{2}},
+		{"\x1b[?1049h", FnDECSET, []int{1049}},
+		{"\x1b[?25;1l", FnDECRST, []int{25, 1}},
+		{"\x1b[4h", FnSM, []int{4}},
+		{"\x1b[1;31m", FnSGR, []int{1, 31}},
+		{"\x1b[5;20r", FnDECSTBM, []int{5, 20}},
+		{"\x1b[c", FnDA1, []int{0}},
+		{"\x1b[>c", FnDA2, []int{0}},
+		{"\x1b[=c", FnDA3, []int{0}},
+		{"\x1b[6n", FnDSR, []int{6}},
+		{"\x1b[>q", FnXTVERSION, nil},
+		{"\x1b[?2004$p", FnDECRQMPrivate, []int{2004}},
+		{"\x1b[2 q", FnDECSCUSR, []int{2}},
+		{"\x1b[>1u", FnKittyKeyboardPush, []int{1}},
+		{"\x1b[<u", FnKittyKeyboardPop, []int{1}},
+		{"\x1b[?u", FnKittyKeyboardQuery, nil},
+		{"\x1b[y", FnUnknown, nil},
+		{"\x1b[?1;2;3$$p", FnUnknown, nil},
+		{"\x1b7", FnDECSC, nil},
+		{"\x1bM", FnRI, nil},
+		{"\x1b#8", FnDECALN, nil},
+		{"\x1b(0", FnSCS, nil},
+		{"\x1b%G", FnUnknown, nil},
+		{"\x1b]8;id=1;http://example.com\x1b\\", FnOscHyperlink, nil},
+		{"\x1b]11;?\x07", FnOscBackground, nil},
+		{"\x1b]777;notify\x07", FnUnknown, nil},
+		{"\x1bP$qm\x1b\\", FnDECRQSS, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			events := collect(t, tc.input)
+			if len(events) == 0 {
+				t.Fatal("nothing was dispatched")
+			}
+
+			fn := identifyEvent(events[0])
+			if fn.ID != tc.id {
+				t.Fatalf("got %v, want %v", fn, tc.id)
+			}
+
+			args := make([]int, 0)
+			for i := range tc.args {
+				args = append(args, fn.Arg(i))
+			}
+			if len(tc.args) > 0 && !reflect.DeepEqual(args, tc.args) {
+				t.Errorf("%v: got args %v, want %v", fn, args, tc.args)
+			}
+		})
+	}
+}
+
+func TestIdentifyOsc_Fields(t *testing.T) {
+	fn := IdentifyOsc([]byte("4;1;rgb:ff/00/00;2;?"))
+	if fn.ID != FnOscSetColor || fn.Code != 4 {
+		t.Fatalf("got %v", fn)
+	}
+
+	want := []string{"1", "rgb:ff/00/00", "2", "?", ""}
+	for i, w := range want {
+		if got := string(fn.Field(i)); got != w {
+			t.Errorf("field %d: got %q, want %q", i, got, w)
+		}
+	}
+
+	if fn := IdentifyOsc([]byte("x;1")); fn.ID != FnUnknown || fn.Code != -1 {
+		t.Errorf("got %v", fn)
+	}
+}
+
+func TestIdentify_SCS(t *testing.T) {
+	fn := identifyEvent(collect(t, "\x1b)B")[0])
+	if fn.ID != FnSCS || string(fn.Intermediates) != ")" || fn.Final != 'B' {
+		t.Errorf("got %v", fn)
+	}
+}
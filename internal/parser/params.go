@@ -0,0 +1,149 @@
+package parser
+
+import "strconv"
+
+const (
+	// values above this are clamped, like xterm and vte do
+	MaxParamValue = 65535
+	// parameters and sub-parameters past this count are dropped
+	MaxParams = 32
+)
+
+// omitted marks a value that was left empty, as in CSI ;5H.
+const omitted = -1
+
+// Params are the parameters of a CSI or DCS sequence. They are collected in
+// place as the bytes arrive, so parsing them never allocates.
+type Params struct {
+	// values holds every parameter followed by its sub-parameters
+	values [MaxParams]int32
+	starts [MaxParams]uint8
+	lens   [MaxParams]uint8
+	count  int
+	total  int
+	full   bool
+}
+
+// Param is one ';' separated parameter. The first value is the parameter
+// itself, the following ones are its ':' separated sub-parameters, as in
+// SGR 38:2::R:G:B or 4:3. It points into its Params.
+type Param struct {
+	values []int32
+}
+
+func (p Param) Omitted() bool {
+	return len(p.values) == 0 || p.values[0] == omitted
+}
+
+// Value returns the parameter, or def when it was omitted.
+func (p Param) Value(def int) int {
+	if p.Omitted() {
+		return def
+	}
+	return int(p.values[0])
+}
+
+func (p Param) HasSubs() bool {
+	return len(p.values) > 1
+}
+
+func (p Param) SubLen() int {
+	return max(len(p.values)-1, 0)
+}
+
+// Sub returns the i-th sub-parameter, or def when it is missing or omitted.
+func (p Param) Sub(i, def int) int {
+	if i < 0 || i+1 >= len(p.values) || p.values[i+1] == omitted {
+		return def
+	}
+	return int(p.values[i+1])
+}
+
+func (p *Params) Len() int {
+	return p.count
+}
+
+// Param returns the i-th parameter, an omitted one when it is missing.
+func (p *Params) Param(i int) Param {
+	if i < 0 || i >= p.count {
+		return Param{}
+	}
+	start := int(p.starts[i])
+	return Param{values: p.values[start : start+int(p.lens[i])]}
+}
+
+// Get returns the value of the i-th parameter, or def when it is missing or omitted.
+func (p *Params) Get(i, def int) int {
+	return p.Param(i).Value(def)
+}
+
+func (p *Params) reset() {
+	p.count, p.total, p.full = 0, 0, false
+}
+
+// next starts a new value, a parameter or one of its sub-parameters.
+func (p *Params) next(sub bool) {
+	if p.full || p.total == MaxParams {
+		p.full = true
+		return
+	}
+
+	if sub {
+		p.lens[p.count-1]++
+	} else {
+		p.starts[p.count] = uint8(p.total)
+		p.lens[p.count] = 1
+		p.count++
+	}
+	p.values[p.total] = omitted
+	p.total++
+}
+
+func (p *Params) collect(c byte) {
+	if p.count == 0 {
+		p.next(false)
+	}
+
+	switch c {
+	case ';':
+		p.next(false)
+	case ':':
+		p.next(true)
+	default:
+		if p.full {
+			return
+		}
+		v := &p.values[p.total-1]
+		if *v == omitted {
+			*v = 0
+		}
+		*v = min(*v*10+int32(c-'0'), MaxParamValue)
+	}
+}
+
+// String formats the parameters the way they appear in a sequence.
+func (p *Params) String() string {
+	b := make([]byte, 0, p.total*3)
+	for i := range p.count {
+		if i > 0 {
+			b = append(b, ';')
+		}
+		for j, v := range p.Param(i).values {
+			if j > 0 {
+				b = append(b, ':')
+			}
+			if v != omitted {
+				b = strconv.AppendInt(b, int64(v), 10)
+			}
+		}
+	}
+	return string(b)
+}
+
+func parseParams(raw []byte) Params {
+	var params Params
+	for _, c := range raw {
+		params.collect(c)
+	}
+	return params
+}
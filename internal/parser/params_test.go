@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func values(params *Params) [][]int {
+	out := make([][]int, 0, params.Len())
+	for i := range params.Len() {
+		p := make([]int, 0)
+		for _, v := range params.Param(i).values {
+			p = append(p, int(v))
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func TestParseParams(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want [][]int
+	}{
+		{"", [][]int{}},
+		{"1", [][]int{{1}}},
+		{"1;2", [][]int{{1}, {2}}},
+		{";5", [][]int{{omitted}, {5}}},
+		{"5;", [][]int{{5}, {omitted}}},
+		{"38:2::10:20:30", [][]int{{38, 2, omitted, 10, 20, 30}}},
+		{"4:3;1", [][]int{{4, 3}, {1}}},
+		{"99999999", [][]int{{MaxParamValue}}},
+		{"1:2:3:4:5:6:7:8;9;10;11;12;13;14;15;16;17;18;19;20;21;22;23;24;25;26;27;28;29;30;31;32;33", [][]int{
+			{1, 2, 3, 4, 5, 6, 7, 8}, {9}, {10}, {11}, {12}, {13}, {14}, {15}, {16}, {17}, {18}, {19}, {20},
+			{21}, {22}, {23}, {24}, {25}, {26}, {27}, {28}, {29}, {30}, {31}, {32}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.raw, func(t *testing.T) {
+			params := parseParams([]byte(tc.raw))
+			if got := values(&params); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParams_Defaults(t *testing.T) {
+	params := parseParams([]byte(";0;38:2::10:20:30"))
+
+	if got := params.Get(0, 1); got != 1 {
+		t.Errorf("omitted param: got %d, want 1", got)
+	}
+	if got := params.Get(1, 1); got != 0 {
+		t.Errorf("explicit zero: got %d, want 0", got)
+	}
+	if got := params.Get(7, 42); got != 42 {
+		t.Errorf("missing param: got %d, want 42", got)
+	}
+
+	p := params.Param(2)
+	if params.String() != ";0;38:2::10:20:30" {
+		t.Errorf("unexpected string %q", params.String())
+	}
+	if p.Value(0) != 38 || p.SubLen() != 5 {
+		t.Fatalf("unexpected param %v", p.values)
+	}
+	if p.Sub(0, 0) != 2 || p.Sub(1, -7) != -7 || p.Sub(4, 0) != 30 || p.Sub(5, 9) != 9 {
+		t.Errorf("unexpected sub-parameters %v", p.values)
+	}
+}
+
+func TestParser_CsiSubParams(t *testing.T) {
+	events := collect(t, "\x1b[4:3m\x1b[38:2::1:2:3;1m")
+	if len(events) != 2 {
+		t.Fatalf("expected 2 dispatches, got %d", len(events))
+	}
+
+	if p := events[0].Params().Param(0); p.Value(0) != 4 || p.Sub(0, 0) != 3 {
+		t.Errorf("unexpected params %v", values(events[0].Params()))
+	}
+	if got := values(events[1].Params()); !reflect.DeepEqual(got, [][]int{{38, 2, omitted, 1, 2, 3}, {1}}) {
+		t.Errorf("unexpected params %v", got)
+	}
+}
@@ -1,146 +1,374 @@
 package parser
 
 import (
-	"bufio"
 	"context"
 	"io"
-	"log"
+	"unicode/utf8"
 )
 
-type State string
-type Action string
+type State uint8
+type Action uint8
 
 const (
-	StateGround             State = "ground"
-	StateSosPmApcString           = "sos-pm-apc"
-	StateEscape                   = "escape"
-	StateEscapeIntermediate       = "escape-intermediate"
-	StateCsiEntry                 = "csi-entry"
-	StateCsiIgnore                = "csi-ignore"
-	StateCsiParam                 = "csi-param"
-	StateCsiIntermediate          = "csi-intermediate"
-	StateOscString                = "osc-string"
-	StateDcsEntry                 = "dcs-entry"
-	StateDcsIgnore                = "dcs-ignore"
-	StateDcsIntermediate          = "dcs-intermediate"
-	StateDcsParam                 = "dcs-param"
-	StateDcsPassthrough           = "dcs-passthrough"
+	StateGround State = iota
+	StateSosPmApcString
+	StateEscape
+	StateEscapeIntermediate
+	StateCsiEntry
+	StateCsiIgnore
+	StateCsiParam
+	StateCsiIntermediate
+	StateOscString
+	StateDcsEntry
+	StateDcsIgnore
+	StateDcsIntermediate
+	StateDcsParam
+	StateDcsPassthrough
+	stateCount
 )
+
 const (
-	ActionNone        Action = "none"
-	ActionClear              = "clear"
-	ActionCollect            = "collect"
-	ActionCsiDispatch        = "csi.dispatch"
-	ActionEscDispatch        = "esc.dispatch"
-	ActionExecute            = "execute"
-	ActionHook               = "hook"
-	ActionIgnore             = "ignore"
-	ActionOscEnd             = "osc.end"
-	ActionOscPut             = "osc.put"
-	ActionOscStart           = "osc.start"
-	ActionParam              = "param"
-	ActionPrint              = "print"
-	ActionPut                = "put"
-	ActionUnhook             = "unhook"
+	ActionNone Action = iota
+	ActionClear
+	ActionCollect
+	ActionCsiDispatch
+	ActionEscDispatch
+	ActionExecute
+	ActionHook
+	ActionIgnore
+	ActionOscEnd
+	ActionOscPut
+	ActionOscStart
+	ActionParam
+	ActionPrint
+	ActionPut
+	ActionUnhook
+	ActionStringDispatch
+	actionCount
 )
 
-type Parser struct {
-	src    io.Reader
-	state  State
-	event  *ParserEvent
-	ctx    context.Context
-	cancel context.CancelFunc
+var stateNames = [stateCount]string{
+	StateGround:             "ground",
+	StateSosPmApcString:     "sos-pm-apc",
+	StateEscape:             "escape",
+	StateEscapeIntermediate: "escape-intermediate",
+	StateCsiEntry:           "csi-entry",
+	StateCsiIgnore:          "csi-ignore",
+	StateCsiParam:           "csi-param",
+	StateCsiIntermediate:    "csi-intermediate",
+	StateOscString:          "osc-string",
+	StateDcsEntry:           "dcs-entry",
+	StateDcsIgnore:          "dcs-ignore",
+	StateDcsIntermediate:    "dcs-intermediate",
+	StateDcsParam:           "dcs-param",
+	StateDcsPassthrough:     "dcs-passthrough",
+}
+
+var actionNames = [actionCount]string{
+	ActionNone:           "none",
+	ActionClear:          "clear",
+	ActionCollect:        "collect",
+	ActionCsiDispatch:    "csi.dispatch",
+	ActionEscDispatch:    "esc.dispatch",
+	ActionExecute:        "execute",
+	ActionHook:           "hook",
+	ActionIgnore:         "ignore",
+	ActionOscEnd:         "osc.end",
+	ActionOscPut:         "osc.put",
+	ActionOscStart:       "osc.start",
+	ActionParam:          "param",
+	ActionPrint:          "print",
+	ActionPut:            "put",
+	ActionUnhook:         "unhook",
+	ActionStringDispatch: "string.dispatch",
+}
+
+func (s State) String() string {
+	if s >= stateCount {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+func (a Action) String() string {
+	if a >= actionCount {
+		return "unknown"
+	}
+	return actionNames[a]
+}
 
+// DefaultMaxPayload caps the bytes buffered for a single OSC, DCS, SOS, PM
+// or APC string, the rest of a longer string is dropped.
+const DefaultMaxPayload = 1 << 20
+
+type Parser struct {
+	src       io.Reader
+	state     State
+	seq       *sequence
+	decoder   utf8Decoder
+	c1        bool
+	performer Performer
+	// text is the run of printable characters not yet handed to the performer
+	text []rune
+	// maxPayload caps the buffered string payload
+	maxPayload int
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// Queue receives the events unless the parser was given a Performer.
 	Queue chan ParserEvent
 }
 
-func New(ctx context.Context, src io.Reader) *Parser {
+type Option func(*Parser)
+
+// WithC1Controls makes the parser recognise 8-bit C1 controls (0x80-0x9f).
+// They collide with UTF-8 continuation bytes, so it is off by default.
+func WithC1Controls() Option {
+	return func(p *Parser) {
+		p.c1 = true
+	}
+}
+
+// WithMaxPayload sets how many bytes of a string sequence are buffered.
+func WithMaxPayload(n int) Option {
+	return func(p *Parser) {
+		p.maxPayload = n
+	}
+}
+
+// WithPerformer delivers the parsed sequences to performer instead of Queue.
+func WithPerformer(performer Performer) Option {
+	return func(p *Parser) {
+		p.performer = performer
+	}
+}
+
+// New starts a parser that reads src on its own goroutine until EOF.
+func New(ctx context.Context, src io.Reader, opts ...Option) *Parser {
+	self := NewSync(ctx, opts...)
+	self.src = src
+
+	go self.worker()
+
+	return self
+}
+
+// NewSync creates a parser without a reader, it only advances when Feed is
+// called. Without a Performer, Queue has to be drained while feeding.
+func NewSync(ctx context.Context, opts ...Option) *Parser {
 	ctx, cancel := context.WithCancel(ctx)
 
 	self := &Parser{
-		src:    src,
-		state:  StateGround,
-		event:  newParserEvent(),
-		Queue:  make(chan ParserEvent, 256),
-		ctx:    ctx,
-		cancel: cancel,
+		state:      StateGround,
+		seq:        newSequence(),
+		maxPayload: DefaultMaxPayload,
+		text:       make([]rune, 0, 256),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
+	self.decoder.reset()
 
-	go self.worker()
+	for _, opt := range opts {
+		opt(self)
+	}
+
+	if self.performer == nil {
+		q := newQueue(ctx, self.maxPayload)
+		self.performer = q
+		self.Queue = q.ch
+	}
 
 	return self
 }
 
 func (self *Parser) Close() {
 	self.cancel()
-	close(self.Queue)
+	if self.Queue != nil {
+		close(self.Queue)
+	}
+}
+
+// Feed runs the state machine over p, dispatching inline. Sequences may be
+// split across calls, printed text is handed over before Feed returns.
+func (self *Parser) Feed(p []byte) {
+	for _, c := range p {
+		// fast path for plain text
+		if self.state == StateGround && isBetween(c, 0x20, 0x7e) && !self.decoder.pending() {
+			self.text = append(self.text, rune(c))
+			continue
+		}
+		self.feed(c)
+	}
+	self.flush()
 }
 
 func (self *Parser) worker() {
-	reader := bufio.NewReader(self.src)
+	buf := make([]byte, 4096)
 	for {
 		select {
 		case <-self.ctx.Done():
 			return
 		default:
-			b, err := reader.ReadByte()
-			if err == io.EOF {
+			n, err := self.src.Read(buf)
+			self.Feed(buf[:n])
+			if err != nil {
 				return
 			}
-			self.feed(b)
 		}
 	}
 }
 
 func (self *Parser) feed(c byte) {
+	if self.state == StateGround && (c >= 0x80 || self.decoder.pending()) && !self.isC1(c) {
+		r, status := self.decoder.decode(c)
+		switch status {
+		case utf8Done:
+			self.print(r)
+			return
+		case utf8Invalid:
+			self.print(utf8.RuneError)
+			self.feed(c)
+			return
+		default:
+			return
+		}
+	}
+
 	// transition to the next state by visiting the new char
 	state, action := self.transition(c)
 
+	if state != self.state {
+		self.leave(c)
+	}
+
 	// preform the action
 	self.act(action, c)
 
+	if state != self.state {
+		self.enter(state, c)
+	}
+
 	// change the state
 	self.state = state
 }
 
+// enter runs the entry action of the string states, c is the introducer.
+func (self *Parser) enter(state State, c byte) {
+	switch state {
+	case StateOscString:
+		self.seq.startString(KindOsc)
+	case StateDcsPassthrough:
+		self.seq.final = c
+		self.seq.startString(KindDcs)
+		self.dispatch(ActionHook)
+	case StateSosPmApcString:
+		switch c {
+		case 0x58, 0x98:
+			self.seq.startString(KindSos)
+		case 0x5e, 0x9e:
+			self.seq.startString(KindPm)
+		default:
+			self.seq.startString(KindApc)
+		}
+	}
+}
+
+// leave runs the exit action of the string states, the string is
+// dispatched unless it was cancelled by CAN or SUB.
+func (self *Parser) leave(c byte) {
+	switch self.state {
+	case StateDcsPassthrough:
+		self.dispatch(ActionUnhook)
+	case
+		StateOscString,
+		StateSosPmApcString:
+		if c == 0x18 || c == 0x1a {
+			self.seq.clear()
+			return
+		}
+		self.seq.bell = c == 0x07
+		self.dispatch(ActionStringDispatch)
+	}
+}
+
+func (self *Parser) isC1(c byte) bool {
+	return self.c1 && !self.decoder.pending() && isBetween(c, 0x80, 0x9f)
+}
+
+func (self *Parser) print(r rune) {
+	self.text = append(self.text, r)
+}
+
+// flush hands the pending run of printable text to the performer.
+func (self *Parser) flush() {
+	if len(self.text) == 0 {
+		return
+	}
+	self.performer.Print(self.text)
+	self.text = self.text[:0]
+}
+
 func (self *Parser) dispatch(action Action) {
-	self.event.name = string(action)
+	self.flush()
 
-	select {
-	case <-self.ctx.Done():
-		log.Fatal(self.ctx.Err())
-	case self.Queue <- *self.event:
-		self.event.rest()
+	seq := self.seq
+	switch action {
+	case ActionExecute:
+		self.performer.Execute(seq.char)
+	case ActionCsiDispatch:
+		self.performer.CsiDispatch(&seq.params, seq.collected(), seq.final)
+	case ActionEscDispatch:
+		self.performer.EscDispatch(seq.collected(), seq.final)
+	case ActionHook:
+		self.performer.Hook(&seq.params, seq.collected(), seq.final)
+		return
+	case ActionUnhook:
+		self.performer.Unhook()
+	case ActionStringDispatch:
+		if seq.kind == KindOsc {
+			self.performer.OscDispatch(seq.payload, seq.bell, seq.truncated)
+		} else {
+			self.performer.SosPmApcDispatch(seq.kind, seq.payload, seq.truncated)
+		}
 	}
+
+	seq.rest()
 }
 
 func (self *Parser) act(action Action, c byte) {
-	self.event.char = c
-	self.event.expr = append(self.event.expr, c)
+	self.seq.char = c
 
 	switch action {
 	case ActionClear:
-		self.event.clear()
+		self.seq.clear()
 	case ActionCollect:
-		self.event.intermediates = append(self.event.intermediates, c)
+		self.seq.collect(c)
 	case ActionParam:
-		self.event.params = append(self.event.params, c)
+		self.seq.params.collect(c)
 	case
 		ActionCsiDispatch,
-		ActionEscDispatch,
-		ActionUnhook:
-		self.event.final = c
+		ActionEscDispatch:
+		self.seq.final = c
+		self.dispatch(action)
+	case ActionPut:
+		if self.state == StateDcsPassthrough {
+			self.flush()
+			self.performer.Put(c)
+			return
+		}
+		self.seq.put(c, self.maxPayload)
+	case ActionOscPut:
+		self.seq.put(c, self.maxPayload)
+	case ActionPrint:
+		self.print(rune(c))
+	case ActionExecute:
 		self.dispatch(action)
 	case
-		ActionPut,
-		ActionPrint,
+		// strings are started and dispatched by enter and leave
 		ActionHook,
 		ActionOscStart,
-		ActionOscPut,
 		ActionOscEnd,
-		ActionExecute:
-		self.dispatch(action)
-	case
+		ActionUnhook,
 		ActionIgnore,
 		ActionNone:
 	}
@@ -148,269 +376,18 @@ func (self *Parser) act(action Action, c byte) {
 }
 
 func (self *Parser) transition(c byte) (State, Action) {
-	switch self.state {
-
-	case StateGround:
-		switch {
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateGround, ActionExecute
-		case isBetween(c, 0x20, 0x7f):
-			return StateGround, ActionPrint
-		}
-
-	case StateEscape:
-		switch {
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateEscape, ActionExecute
-		case c == 0x7f:
-			return StateEscape, ActionIgnore
-
-		case isBetween(c, 0x20, 0x2f):
-			return StateEscapeIntermediate, ActionCollect
-		case c == 0x5b:
-			return StateCsiEntry, ActionClear
-		case c == 0x50:
-			return StateDcsEntry, ActionClear
-		case c == 0x5d:
-			return StateOscString, ActionOscStart
-		case c == 0x58, c == 0x5e, c == 0x5f:
-			return StateSosPmApcString, ActionNone
-		case
-			c == 0x59,
-			c == 0x5a,
-			c == 0x5c,
-			isBetween(c, 0x30, 0x4f),
-			isBetween(c, 0x51, 0x57),
-			isBetween(c, 0x60, 0x7e):
-			return StateGround, ActionEscDispatch
-		}
-
-	case StateEscapeIntermediate:
-		switch {
-		case c == 0x7f:
-			return StateEscapeIntermediate, ActionIgnore
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateEscapeIntermediate, ActionExecute
-		case isBetween(c, 0x20, 0x2f):
-			return StateEscapeIntermediate, ActionCollect
-
-		case isBetween(c, 0x30, 0x7e):
-			return StateGround, ActionEscDispatch
-		}
-
-	case StateCsiEntry:
-		switch {
-		case c == 0x7f:
-			return StateCsiEntry, ActionIgnore
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateCsiEntry, ActionExecute
-
-		case c == 0x3a:
-			return StateCsiIgnore, ActionNone
-		case isBetween(c, 0x20, 0x2f):
-			return StateCsiIntermediate, ActionCollect
-		case
-			c == 0x3b,
-			isBetween(c, 0x30, 0x39):
-			return StateCsiParam, ActionParam
-		case isBetween(c, 0x3c, 0x3f):
-			return StateCsiParam, ActionCollect
-		case isBetween(c, 0x40, 0x7e):
-			return StateGround, ActionCsiDispatch
-		}
-	case StateCsiIgnore:
-		switch {
-		case
-			c == 0x7f,
-			isBetween(c, 0x20, 0x3f):
-			return StateCsiIgnore, ActionIgnore
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateCsiIgnore, ActionExecute
-
-		case isBetween(c, 0x40, 0x7e):
-			return StateGround, ActionNone
-		}
-	case StateCsiIntermediate:
-		switch {
-		case c == 0x7f:
-			return StateCsiIntermediate, ActionIgnore
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateCsiIntermediate, ActionExecute
-		case isBetween(c, 0x20, 0x2f):
-			return StateCsiIntermediate, ActionCollect
-
-		case isBetween(c, 0x40, 0x7e):
-			return StateGround, ActionCsiDispatch
-		}
-	case StateCsiParam:
-		switch {
-
-		case c == 0x7f:
-			return StateCsiParam, ActionIgnore
-		case
-			c == 0x19,
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x00, 0x17):
-			return StateCsiParam, ActionExecute
-		case
-			c == 0x3b,
-			isBetween(c, 0x30, 0x39):
-			return StateCsiParam, ActionParam
-
-		case isBetween(c, 0x20, 0x2f):
-			return StateCsiIntermediate, ActionCollect
-		case isBetween(c, 0x40, 0x7e):
-			return StateGround, ActionCsiDispatch
-		}
-	case StateOscString:
-		switch {
-		case
-			c == 0x19,
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x1c, 0x1f):
-			return StateOscString, ActionIgnore
-		case isBetween(c, 0x20, 0x7f):
+	if c >= 0x80 && !self.isC1(c) {
+		// without C1 recognition high bytes are only meaningful as string payload
+		switch self.state {
+		case StateOscString:
 			return StateOscString, ActionOscPut
-
-		case c == 0x9c:
-			return StateGround, ActionOscEnd
-		}
-	case StateDcsEntry:
-		switch {
-		case
-			c == 0x7f,
-			c == 0x19,
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x1c, 0x1f):
-			return StateDcsEntry, ActionIgnore
-
-		case c == 0x3a:
-			return StateDcsIgnore, ActionIgnore
-		case isBetween(c, 0x20, 0x2f):
-			return StateDcsIntermediate, ActionCollect
-		case
-			c == 0x3b,
-			isBetween(c, 0x30, 0x39):
-			return StateDcsParam, ActionParam
-		case isBetween(c, 0x3c, 0x3f):
-			return StateDcsParam, ActionParam
-		case isBetween(c, 0x40, 0x7e):
-			return StateDcsPassthrough, ActionHook
-
-		}
-	case StateDcsIgnore:
-		switch {
-		case
-			c == 0x19,
-			isBetween(c, 0x20, 0x7f),
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x1c, 0x1f):
-			return StateDcsIgnore, ActionIgnore
-
-		case c == 0x9c:
-			return StateGround, ActionNone
-		}
-
-	case StateDcsParam:
-		switch {
-		case
-			c == 0x7f, c == 0x19,
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x1c, 0x1f):
-			return StateDcsParam, ActionIgnore
-		case
-			c == 0x3b,
-			isBetween(c, 0x30, 0x39):
-			return StateDcsParam, ActionParam
-
-		case
-			c == 0x3a,
-			isBetween(c, 0x3c, 0x3f):
-			return StateDcsIgnore, ActionNone
-		case isBetween(c, 0x20, 0x2f):
-			return StateDcsIntermediate, ActionCollect
-		case isBetween(c, 0x40, 0x7e):
-			return StateDcsPassthrough, ActionHook
-		}
-	case StateDcsIntermediate:
-		switch {
-		case
-			c == 0x7f, c == 0x19,
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x1c, 0x1f):
-			return StateCsiIntermediate, ActionIgnore
-		case isBetween(c, 0x20, 0x2f):
-			return StateDcsIntermediate, ActionCollect
-
-		case isBetween(c, 0x30, 0x3f):
-			return StateDcsIgnore, ActionNone
-		case isBetween(c, 0x40, 0x7e):
-			return StateDcsPassthrough, ActionNone
-		}
-	case StateDcsPassthrough:
-		switch {
-		case c == 0x7f:
-			return StateDcsPassthrough, ActionIgnore
-		case
-			c == 0x19,
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x20, 0x7e),
-			isBetween(c, 0x1c, 0x1f):
+		case StateDcsPassthrough:
 			return StateDcsPassthrough, ActionPut
+		case StateSosPmApcString:
+			return StateSosPmApcString, ActionPut
 		}
-	case StateSosPmApcString:
-		switch {
-		case
-			c == 0x19,
-			isBetween(c, 0x00, 0x17),
-			isBetween(c, 0x1c, 0x1f),
-			isBetween(c, 0x20, 0x7f):
-			return StateOscString, ActionNone
-
-		case c == 0x9c:
-			return StateGround, ActionNone
-		}
-	}
-
-	// anywhere
-	switch {
-	case
-		c == 0x18, c == 0x1a,
-		isBetween(c, 0x80, 0x8f),
-		isBetween(c, 0x91, 0x97),
-		isBetween(c, 0x99, 0x9A):
-		return StateGround, ActionExecute
-	case c == 0x1b:
-		return StateEscape, ActionClear
-	case c == 0x9b:
-		return StateCsiEntry, ActionClear
-	case c == 0x9d:
-		return StateOscString, ActionNone
-	case c == 0x98, c == 0x9e, c == 0x9f:
-		return StateSosPmApcString, ActionNone
-	case c == 0x90:
-		return StateDcsEntry, ActionClear
-	case c == 0x9c:
-		return StateGround, ActionUnhook
+		return self.state, ActionIgnore
 	}
 
-	return self.state, ActionNone
+	return table[self.state][c].unpack()
 }
@@ -5,34 +5,94 @@ import (
 	"strconv"
 )
 
+// StringKind is the introducer of a string sequence.
+type StringKind int
+
+const (
+	KindNone StringKind = iota
+	KindOsc
+	KindDcs
+	KindSos
+	KindPm
+	KindApc
+)
+
+func (k StringKind) String() string {
+	switch k {
+	case KindOsc:
+		return "OSC"
+	case KindDcs:
+		return "DCS"
+	case KindSos:
+		return "SOS"
+	case KindPm:
+		return "PM"
+	case KindApc:
+		return "APC"
+	}
+	return "none"
+}
+
+// ParserEvent is a dispatched sequence as it is delivered on Parser.Queue.
 type ParserEvent struct {
-	name          string
-	expr          []byte
-	params        []byte
+	action        Action
+	params        Params
 	intermediates []byte
 	char          byte
+	r             rune
 	final         byte
+
+	kind      StringKind
+	payload   []byte
+	truncated bool
+	bell      bool
+}
+
+func (e *ParserEvent) Action() Action {
+	return e.action
+}
+
+func (e *ParserEvent) Char() byte {
+	return e.char
+}
+
+// Rune is the decoded character of a print event.
+func (e *ParserEvent) Rune() rune {
+	return e.r
+}
+
+func (e *ParserEvent) Final() byte {
+	return e.final
+}
+
+func (e *ParserEvent) Intermediates() []byte {
+	return e.intermediates
+}
+
+func (e *ParserEvent) Params() *Params {
+	return &e.params
+}
+
+// Kind is the introducer of a string dispatch.
+func (e *ParserEvent) Kind() StringKind {
+	return e.kind
 }
 
-func newParserEvent() *ParserEvent {
-	e := &ParserEvent{}
-	e.rest()
-	return e
+// Payload is the body of a string dispatch, without introducer and terminator.
+func (e *ParserEvent) Payload() []byte {
+	return e.payload
 }
 
-func (e *ParserEvent) rest() {
-	e.name = "unknown"
-	e.char = 0x0
-	e.expr = make([]byte, 0)
-	e.clear()
+// Truncated reports whether the payload hit the parser's size limit.
+func (e *ParserEvent) Truncated() bool {
+	return e.truncated
 }
 
-func (e *ParserEvent) clear() {
-	e.final = 0x0
-	e.params = make([]byte, 0)
-	e.intermediates = make([]byte, 0)
+// Bell reports whether an OSC string was terminated by BEL rather than ST.
+func (e *ParserEvent) Bell() bool {
+	return e.bell
 }
 
 func (t *ParserEvent) String() string {
-	return fmt.Sprintf("] %-12s: v=%-5s  F=%-5s P=%v I=%v", t.name, strconv.Quote(string(t.char)), strconv.Quote(string(t.final)), t.params, t.intermediates)
+	return fmt.Sprintf("] %-12s: v=%-5s  F=%-5s P=%q I=%q", t.action, strconv.Quote(string(t.char)), strconv.Quote(string(t.final)), t.params.String(), t.intermediates)
 }
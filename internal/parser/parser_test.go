@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"context"
+	"testing"
+)
+
+// collect feeds input through a parser byte by byte and returns the
+// dispatched events.
+func collect(t *testing.T, input string, opts ...Option) []ParserEvent {
+	t.Helper()
+
+	p := NewSync(context.Background(), opts...)
+
+	events := make([]ParserEvent, 0)
+	for _, c := range []byte(input) {
+		p.Feed([]byte{c})
+		for len(p.Queue) > 0 {
+			events = append(events, <-p.Queue)
+		}
+	}
+	return events
+}
+
+func printed(events []ParserEvent) string {
+	runes := make([]rune, 0)
+	for _, e := range events {
+		if e.Action() == ActionPrint {
+			runes = append(runes, e.Rune())
+		}
+	}
+	return string(runes)
+}
+
+func TestParser_UTF8(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{"ascii", "hello", "hello"},
+		{"two bytes", "caf\xc3\xa9", "café"},
+		{"cjk", "\xe6\x97\xa5\xe6\x9c\xac", "日本"},
+		{"astral", "\xf0\x9f\x9a\x80", "🚀"},
+		{"nerd font icon", "\xee\x9c\x88", ""},
+		{"stray continuation", "a\x80b", "a�b"},
+		{"truncated", "\xe6\x97a", "�a"},
+		{"overlong", "\xc0\xaf", "��"},
+		{"surrogate", "\xed\xa0\x80", "���"},
+		{"too large", "\xf4\x90\x80\x80", "����"},
+		{"invalid lead", "\xff", "�"},
+		{"interrupted by escape", "\xc3\x1b[m\xc3\xa9", "�é"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := printed(collect(t, tc.input)); got != tc.output {
+				t.Errorf("got %q, want %q", got, tc.output)
+			}
+		})
+	}
+}
+
+func TestParser_C1(t *testing.T) {
+	events := collect(t, "\x9b1m\xc3\xa9")
+	if got := printed(events); got != "�1mé" {
+		t.Errorf("C1 should be off by default, got %q", got)
+	}
+
+	events = collect(t, "\x9b1m\xc3\xa9", WithC1Controls())
+	if len(events) != 2 || events[0].Action() != ActionCsiDispatch || events[0].Final() != 'm' {
+		t.Fatalf("expected a CSI dispatch, got %v", events)
+	}
+	if got := printed(events); got != "é" {
+		t.Errorf("got %q, want %q", got, "é")
+	}
+}
+
+func stringDispatches(events []ParserEvent) []ParserEvent {
+	out := make([]ParserEvent, 0)
+	for _, e := range events {
+		if e.Action() == ActionStringDispatch {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestParser_StringTermination(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		kind    StringKind
+		payload string
+		bell    bool
+		opts    []Option
+	}{
+		{"osc bel", "\x1b]0;title\x07", KindOsc, "0;title", true, nil},
+		{"osc esc st", "\x1b]2;title\x1b\\", KindOsc, "2;title", false, nil},
+		{"osc utf8", "\x1b]2;caf\xc3\xa9\x07", KindOsc, "2;café", true, nil},
+		{"osc c1 st", "\x1b]2;title\x9c", KindOsc, "2;title", false, []Option{WithC1Controls()}},
+		{"osc c1 introducer", "\x9d8;;http://x\x9c", KindOsc, "8;;http://x", false, []Option{WithC1Controls()}},
+		{"dcs", "\x1bP1$qm\x1b\\", KindDcs, "m", false, nil},
+		{"dcs keeps bel", "\x1bPq#0\x07!\x1b\\", KindDcs, "#0\x07!", false, nil},
+		{"sos", "\x1bXhello\x1b\\", KindSos, "hello", false, nil},
+		{"pm", "\x1b^hello\x1b\\", KindPm, "hello", false, nil},
+		{"apc", "\x1b_Gf=100;AAAA\x1b\\", KindApc, "Gf=100;AAAA", false, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := stringDispatches(collect(t, tc.input+"x", tc.opts...))
+			if len(events) != 1 {
+				t.Fatalf("expected one string dispatch, got %d", len(events))
+			}
+			if e := events[0]; e.Kind() != tc.kind || string(e.Payload()) != tc.payload || e.Bell() != tc.bell {
+				t.Errorf("got %v %q bell=%v, want %v %q bell=%v", e.Kind(), e.Payload(), e.Bell(), tc.kind, tc.payload, tc.bell)
+			}
+		})
+	}
+}
+
+func TestParser_DcsHeader(t *testing.T) {
+	events := stringDispatches(collect(t, "\x1bP1;2+q544e\x1b\\"))
+	if len(events) != 1 {
+		t.Fatalf("expected one string dispatch, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Params().Get(0, 0) != 1 || e.Params().Get(1, 0) != 2 || string(e.Intermediates()) != "+" || e.Final() != 'q' {
+		t.Errorf("unexpected DCS header %v", e.String())
+	}
+	if string(e.Payload()) != "544e" {
+		t.Errorf("unexpected payload %q", e.Payload())
+	}
+}
+
+func TestParser_StringCancel(t *testing.T) {
+	if events := stringDispatches(collect(t, "\x1b]0;title\x18\x1b]0;x\x07")); len(events) != 1 || string(events[0].Payload()) != "0;x" {
+		t.Errorf("CAN should drop the string, got %v", events)
+	}
+}
+
+func TestParser_MaxPayload(t *testing.T) {
+	events := stringDispatches(collect(t, "\x1b]0;0123456789\x07", WithMaxPayload(4)))
+	if len(events) != 1 {
+		t.Fatalf("expected one string dispatch, got %d", len(events))
+	}
+	if e := events[0]; string(e.Payload()) != "0;01" || !e.Truncated() {
+		t.Errorf("got %q truncated=%v", e.Payload(), e.Truncated())
+	}
+}
@@ -0,0 +1,22 @@
+package parser
+
+// Performer receives the parsed sequences synchronously, in the order they
+// appear in the input. Params and slices passed to it are owned by the
+// parser and only valid during the call.
+type Performer interface {
+	// Print receives runs of printable characters.
+	Print(text []rune)
+	// Execute receives C0 and C1 control characters.
+	Execute(c byte)
+	CsiDispatch(params *Params, intermediates []byte, final byte)
+	EscDispatch(intermediates []byte, final byte)
+	// Hook starts a DCS string, its body is streamed to Put until Unhook.
+	Hook(params *Params, intermediates []byte, final byte)
+	Put(c byte)
+	Unhook()
+	// OscDispatch receives an OSC payload, truncated when it exceeded the
+	// parser's limit. bell tells a BEL terminated string from one ended by ST,
+	// replies to a query end the way it did.
+	OscDispatch(payload []byte, bell, truncated bool)
+	SosPmApcDispatch(kind StringKind, payload []byte, truncated bool)
+}
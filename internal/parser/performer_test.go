@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// recorder logs every callback it receives.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) log(format string, args ...any) {
+	r.calls = append(r.calls, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Print(text []rune)            { r.log("print %q", string(text)) }
+func (r *recorder) Execute(c byte)               { r.log("execute %#x", c) }
+func (r *recorder) Put(c byte)                   { r.log("put %q", c) }
+func (r *recorder) Unhook()                      { r.log("unhook") }
+func (r *recorder) EscDispatch(i []byte, f byte) { r.log("esc %q %c", i, f) }
+func (r *recorder) CsiDispatch(p *Params, i []byte, f byte) {
+	r.log("csi %d %q %c", p.Get(0, -1), i, f)
+}
+func (r *recorder) Hook(p *Params, i []byte, f byte) {
+	r.log("hook %d %q %c", p.Get(0, -1), i, f)
+}
+func (r *recorder) OscDispatch(payload []byte, bell, truncated bool) {
+	r.log("osc %q", payload)
+}
+func (r *recorder) SosPmApcDispatch(kind StringKind, payload []byte, truncated bool) {
+	r.log("%v %q", kind, payload)
+}
+
+func perform(input string) []string {
+	r := &recorder{}
+	p := NewSync(context.Background(), WithPerformer(r))
+	p.Feed([]byte(input))
+	return r.calls
+}
+
+func TestPerformer(t *testing.T) {
+	got := perform("héllo\r\n\x1b[1mworld\x1b7\x1bP1$qm\x1b\\\x1b]0;t\x07!")
+	want := []string{
+		`print "héllo"`,
+		`execute 0xd`,
+		`execute 0xa`,
+		`csi 1 "" m`,
+		`print "world"`,
+		`esc "" 7`,
+		`hook 1 "$" q`,
+		`put 'm'`,
+		`unhook`,
+		`esc "" \`,
+		`osc "0;t"`,
+		`print "!"`,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestParser_FeedSplit(t *testing.T) {
+	r := &recorder{}
+	p := NewSync(context.Background(), WithPerformer(r))
+	for _, chunk := range []string{"ab\xc3", "\xa9\x1b[3", "1;4", "m\x1b]2;ti", "tle\x1b", "\\"} {
+		p.Feed([]byte(chunk))
+	}
+
+	want := []string{`print "ab"`, `print "é"`, `csi 31 "" m`, `osc "2;title"`, `esc "" \`}
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("got:\n%v\nwant:\n%v", r.calls, want)
+	}
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"context"
+	"log"
+)
+
+// queue is the Performer behind Parser.Queue, it turns every callback into
+// a ParserEvent and buffers DCS strings into a single event.
+type queue struct {
+	ctx   context.Context
+	ch    chan ParserEvent
+	limit int
+	dcs   ParserEvent
+}
+
+func newQueue(ctx context.Context, limit int) *queue {
+	return &queue{
+		ctx:   ctx,
+		ch:    make(chan ParserEvent, 256),
+		limit: limit,
+	}
+}
+
+func (q *queue) send(e ParserEvent) {
+	select {
+	case <-q.ctx.Done():
+		log.Fatal(q.ctx.Err())
+	case q.ch <- e:
+	}
+}
+
+func (q *queue) Print(text []rune) {
+	for _, r := range text {
+		q.send(ParserEvent{action: ActionPrint, r: r, char: byte(r)})
+	}
+}
+
+func (q *queue) Execute(c byte) {
+	q.send(ParserEvent{action: ActionExecute, r: rune(c), char: c})
+}
+
+func (q *queue) CsiDispatch(params *Params, intermediates []byte, final byte) {
+	q.send(ParserEvent{
+		action:        ActionCsiDispatch,
+		params:        *params,
+		intermediates: clone(intermediates),
+		char:          final,
+		final:         final,
+	})
+}
+
+func (q *queue) EscDispatch(intermediates []byte, final byte) {
+	q.send(ParserEvent{
+		action:        ActionEscDispatch,
+		intermediates: clone(intermediates),
+		char:          final,
+		final:         final,
+	})
+}
+
+func (q *queue) Hook(params *Params, intermediates []byte, final byte) {
+	q.dcs = ParserEvent{
+		action:        ActionStringDispatch,
+		params:        *params,
+		intermediates: clone(intermediates),
+		final:         final,
+		kind:          KindDcs,
+		payload:       make([]byte, 0),
+	}
+}
+
+func (q *queue) Put(c byte) {
+	if len(q.dcs.payload) >= q.limit {
+		q.dcs.truncated = true
+		return
+	}
+	q.dcs.payload = append(q.dcs.payload, c)
+}
+
+func (q *queue) Unhook() {
+	q.send(q.dcs)
+	q.dcs = ParserEvent{}
+}
+
+func (q *queue) OscDispatch(payload []byte, bell, truncated bool) {
+	q.send(ParserEvent{
+		action:    ActionStringDispatch,
+		kind:      KindOsc,
+		payload:   clone(payload),
+		truncated: truncated,
+		bell:      bell,
+	})
+}
+
+func (q *queue) SosPmApcDispatch(kind StringKind, payload []byte, truncated bool) {
+	q.send(ParserEvent{
+		action:    ActionStringDispatch,
+		kind:      kind,
+		payload:   clone(payload),
+		truncated: truncated,
+	})
+}
+
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,66 @@
+package parser
+
+// MaxIntermediates is how many intermediate bytes a sequence keeps, the
+// rest are dropped.
+const MaxIntermediates = 4
+
+// sequence collects the pieces of the sequence being parsed until it is
+// dispatched. Its buffers are reused, so steady-state parsing doesn't allocate.
+type sequence struct {
+	params        Params
+	intermediates [MaxIntermediates]byte
+	icount        int
+	char          byte
+	final         byte
+
+	kind      StringKind
+	payload   []byte
+	truncated bool
+	bell      bool
+}
+
+func newSequence() *sequence {
+	s := &sequence{payload: make([]byte, 0, 256)}
+	s.rest()
+	return s
+}
+
+func (s *sequence) rest() {
+	s.char = 0x0
+	s.clear()
+}
+
+func (s *sequence) clear() {
+	s.final = 0x0
+	s.params.reset()
+	s.icount = 0
+	s.kind = KindNone
+	s.payload = s.payload[:0]
+	s.truncated = false
+	s.bell = false
+}
+
+func (s *sequence) collect(c byte) {
+	if s.icount < MaxIntermediates {
+		s.intermediates[s.icount] = c
+		s.icount++
+	}
+}
+
+func (s *sequence) collected() []byte {
+	return s.intermediates[:s.icount]
+}
+
+func (s *sequence) startString(kind StringKind) {
+	s.kind = kind
+	s.payload = s.payload[:0]
+	s.truncated = false
+}
+
+func (s *sequence) put(c byte, limit int) {
+	if len(s.payload) >= limit {
+		s.truncated = true
+		return
+	}
+	s.payload = append(s.payload, c)
+}
@@ -0,0 +1,131 @@
+package parser
+
+// transition packs the next state and the action to perform into a byte.
+type transition uint8
+
+func pack(state State, action Action) transition {
+	return transition(action)<<4 | transition(state)
+}
+
+func (t transition) unpack() (State, Action) {
+	return State(t & 0x0f), Action(t >> 4)
+}
+
+// table is the DEC/Paul Williams state diagram compiled into a lookup of
+// the transition for every state and byte.
+var table = buildTable()
+
+type byteRange struct {
+	lo, hi byte
+}
+
+func only(c byte) byteRange {
+	return byteRange{c, c}
+}
+
+// executable are the C0 controls that are executed without leaving the current sequence.
+var executable = []byteRange{{0x00, 0x17}, only(0x19), {0x1c, 0x1f}}
+
+type tableBuilder [stateCount][256]transition
+
+func (t *tableBuilder) on(state State, ranges []byteRange, next State, action Action) {
+	for _, r := range ranges {
+		for c := int(r.lo); c <= int(r.hi); c++ {
+			t[state][c] = pack(next, action)
+		}
+	}
+}
+
+func (t *tableBuilder) stay(state State, ranges []byteRange, action Action) {
+	t.on(state, ranges, state, action)
+}
+
+func buildTable() [stateCount][256]transition {
+	var t tableBuilder
+
+	for state := range stateCount {
+		t.stay(state, []byteRange{{0x00, 0xff}}, ActionNone)
+	}
+
+	t.stay(StateGround, executable, ActionExecute)
+	t.stay(StateGround, []byteRange{{0x20, 0x7f}}, ActionPrint)
+
+	t.stay(StateEscape, executable, ActionExecute)
+	t.stay(StateEscape, []byteRange{only(0x7f)}, ActionIgnore)
+	t.on(StateEscape, []byteRange{{0x20, 0x2f}}, StateEscapeIntermediate, ActionCollect)
+	t.on(StateEscape, []byteRange{{0x30, 0x4f}, {0x51, 0x57}, only(0x59), only(0x5a), only(0x5c), {0x60, 0x7e}}, StateGround, ActionEscDispatch)
+	t.on(StateEscape, []byteRange{only(0x5b)}, StateCsiEntry, ActionClear)
+	t.on(StateEscape, []byteRange{only(0x50)}, StateDcsEntry, ActionClear)
+	t.on(StateEscape, []byteRange{only(0x5d)}, StateOscString, ActionOscStart)
+	t.on(StateEscape, []byteRange{only(0x58), only(0x5e), only(0x5f)}, StateSosPmApcString, ActionNone)
+
+	t.stay(StateEscapeIntermediate, executable, ActionExecute)
+	t.stay(StateEscapeIntermediate, []byteRange{only(0x7f)}, ActionIgnore)
+	t.stay(StateEscapeIntermediate, []byteRange{{0x20, 0x2f}}, ActionCollect)
+	t.on(StateEscapeIntermediate, []byteRange{{0x30, 0x7e}}, StateGround, ActionEscDispatch)
+
+	t.stay(StateCsiEntry, executable, ActionExecute)
+	t.stay(StateCsiEntry, []byteRange{only(0x7f)}, ActionIgnore)
+	t.on(StateCsiEntry, []byteRange{{0x20, 0x2f}}, StateCsiIntermediate, ActionCollect)
+	t.on(StateCsiEntry, []byteRange{{0x30, 0x3b}}, StateCsiParam, ActionParam)
+	t.on(StateCsiEntry, []byteRange{{0x3c, 0x3f}}, StateCsiParam, ActionCollect)
+	t.on(StateCsiEntry, []byteRange{{0x40, 0x7e}}, StateGround, ActionCsiDispatch)
+
+	t.stay(StateCsiParam, executable, ActionExecute)
+	t.stay(StateCsiParam, []byteRange{only(0x7f)}, ActionIgnore)
+	t.stay(StateCsiParam, []byteRange{{0x30, 0x3b}}, ActionParam)
+	t.on(StateCsiParam, []byteRange{{0x3c, 0x3f}}, StateCsiIgnore, ActionNone)
+	t.on(StateCsiParam, []byteRange{{0x20, 0x2f}}, StateCsiIntermediate, ActionCollect)
+	t.on(StateCsiParam, []byteRange{{0x40, 0x7e}}, StateGround, ActionCsiDispatch)
+
+	t.stay(StateCsiIntermediate, executable, ActionExecute)
+	t.stay(StateCsiIntermediate, []byteRange{only(0x7f)}, ActionIgnore)
+	t.stay(StateCsiIntermediate, []byteRange{{0x20, 0x2f}}, ActionCollect)
+	t.on(StateCsiIntermediate, []byteRange{{0x40, 0x7e}}, StateGround, ActionCsiDispatch)
+
+	t.stay(StateCsiIgnore, executable, ActionExecute)
+	t.stay(StateCsiIgnore, []byteRange{{0x20, 0x3f}, only(0x7f)}, ActionIgnore)
+	t.on(StateCsiIgnore, []byteRange{{0x40, 0x7e}}, StateGround, ActionNone)
+
+	t.stay(StateDcsEntry, append([]byteRange{only(0x7f)}, executable...), ActionIgnore)
+	t.on(StateDcsEntry, []byteRange{{0x20, 0x2f}}, StateDcsIntermediate, ActionCollect)
+	t.on(StateDcsEntry, []byteRange{{0x30, 0x3b}}, StateDcsParam, ActionParam)
+	t.on(StateDcsEntry, []byteRange{{0x3c, 0x3f}}, StateDcsParam, ActionCollect)
+	t.on(StateDcsEntry, []byteRange{{0x40, 0x7e}}, StateDcsPassthrough, ActionHook)
+
+	t.stay(StateDcsParam, append([]byteRange{only(0x7f)}, executable...), ActionIgnore)
+	t.stay(StateDcsParam, []byteRange{{0x30, 0x3b}}, ActionParam)
+	t.on(StateDcsParam, []byteRange{{0x3c, 0x3f}}, StateDcsIgnore, ActionNone)
+	t.on(StateDcsParam, []byteRange{{0x20, 0x2f}}, StateDcsIntermediate, ActionCollect)
+	t.on(StateDcsParam, []byteRange{{0x40, 0x7e}}, StateDcsPassthrough, ActionHook)
+
+	t.stay(StateDcsIntermediate, append([]byteRange{only(0x7f)}, executable...), ActionIgnore)
+	t.stay(StateDcsIntermediate, []byteRange{{0x20, 0x2f}}, ActionCollect)
+	t.on(StateDcsIntermediate, []byteRange{{0x30, 0x3f}}, StateDcsIgnore, ActionNone)
+	t.on(StateDcsIntermediate, []byteRange{{0x40, 0x7e}}, StateDcsPassthrough, ActionHook)
+
+	t.stay(StateDcsPassthrough, append([]byteRange{{0x20, 0x7e}}, executable...), ActionPut)
+	t.stay(StateDcsPassthrough, []byteRange{only(0x7f)}, ActionIgnore)
+
+	t.stay(StateDcsIgnore, append([]byteRange{{0x20, 0x7f}}, executable...), ActionIgnore)
+
+	t.stay(StateOscString, executable, ActionIgnore)
+	t.stay(StateOscString, []byteRange{{0x20, 0x7f}}, ActionOscPut)
+	t.on(StateOscString, []byteRange{only(0x07)}, StateGround, ActionOscEnd)
+
+	t.stay(StateSosPmApcString, append([]byteRange{{0x20, 0x7f}}, executable...), ActionPut)
+
+	// anywhere, these win over every state
+	for state := range stateCount {
+		t.on(state, []byteRange{only(0x18), only(0x1a), {0x80, 0x8f}, {0x91, 0x97}, only(0x99), only(0x9a)}, StateGround, ActionExecute)
+		t.on(state, []byteRange{only(0x1b)}, StateEscape, ActionClear)
+		t.on(state, []byteRange{only(0x9b)}, StateCsiEntry, ActionClear)
+		t.on(state, []byteRange{only(0x9d)}, StateOscString, ActionOscStart)
+		t.on(state, []byteRange{only(0x98), only(0x9e), only(0x9f)}, StateSosPmApcString, ActionNone)
+		t.on(state, []byteRange{only(0x90)}, StateDcsEntry, ActionClear)
+		// ST, the string states dispatch on leave
+		t.on(state, []byteRange{only(0x9c)}, StateGround, ActionNone)
+	}
+
+	return t
+}
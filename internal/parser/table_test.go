@@ -0,0 +1,357 @@
+package parser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTable_MatchesSwitch(t *testing.T) {
+	for state := range stateCount {
+		for c := range 256 {
+			wantState, wantAction := switchTransition(state, byte(c))
+			gotState, gotAction := table[state][c].unpack()
+			if gotState != wantState || gotAction != wantAction {
+				t.Errorf("%v %#02x: got %v/%v, want %v/%v", state, c, gotState, gotAction, wantState, wantAction)
+			}
+		}
+	}
+}
+
+// captureNames are the recordings under testdata, taken with script(1) in a
+// 120x50 terminal: a license text printed with head, ls --color -l of two
+// large directories, and vim paging and searching through parser.go.
+var captureNames = []string{"plain", "ls", "vim"}
+
+func capture(tb testing.TB, name string) []byte {
+	tb.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name+".txt"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// BenchmarkTransition times the transition lookup alone. Its switch baseline
+// is switchTransition, a port of the replaced string based transition to the
+// integer states, so it only compares the table against a switch.
+// BenchmarkFeed measures the whole parser on the same captures.
+func BenchmarkTransition(b *testing.B) {
+	for _, name := range captureNames {
+		input := capture(b, name)
+
+		b.Run(name+"/switch", func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for b.Loop() {
+				state := StateGround
+				for _, c := range input {
+					state, _ = switchTransition(state, c)
+				}
+			}
+		})
+
+		b.Run(name+"/table", func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for b.Loop() {
+				state := StateGround
+				for _, c := range input {
+					state, _ = table[state][c].unpack()
+				}
+			}
+		})
+	}
+}
+
+type discard struct{}
+
+func (discard) Print(text []rune)                                            {}
+func (discard) Execute(c byte)                                               {}
+func (discard) CsiDispatch(params *Params, intermediates []byte, final byte) {}
+func (discard) EscDispatch(intermediates []byte, final byte)                 {}
+func (discard) Hook(params *Params, intermediates []byte, final byte)        {}
+func (discard) Put(c byte)                                                   {}
+func (discard) Unhook()                                                      {}
+func (discard) OscDispatch(payload []byte, bell, truncated bool)             {}
+func (discard) SosPmApcDispatch(kind StringKind, payload []byte, truncated bool) {
+}
+
+func TestFeed_ZeroAlloc(t *testing.T) {
+	for _, name := range captureNames {
+		input := capture(t, name)
+		p := NewSync(context.Background(), WithPerformer(discard{}))
+		p.Feed(input)
+
+		if allocs := testing.AllocsPerRun(10, func() { p.Feed(input) }); allocs != 0 {
+			t.Errorf("%s: %v allocations per feed", name, allocs)
+		}
+	}
+}
+
+func BenchmarkFeed(b *testing.B) {
+	for _, name := range captureNames {
+		input := capture(b, name)
+
+		b.Run(name, func(b *testing.B) {
+			p := NewSync(context.Background(), WithPerformer(discard{}))
+			b.ReportAllocs()
+			b.SetBytes(int64(len(input)))
+			for b.Loop() {
+				p.Feed(input)
+			}
+		})
+	}
+}
+
+// switchTransition is the switch based transition the table replaced, ported
+// to the integer states. It is kept to check the table against and to
+// benchmark it.
+func switchTransition(state State, c byte) (State, Action) {
+	switch state {
+
+	case StateGround:
+		switch {
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateGround, ActionExecute
+		case isBetween(c, 0x20, 0x7f):
+			return StateGround, ActionPrint
+		}
+
+	case StateEscape:
+		switch {
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateEscape, ActionExecute
+		case c == 0x7f:
+			return StateEscape, ActionIgnore
+
+		case isBetween(c, 0x20, 0x2f):
+			return StateEscapeIntermediate, ActionCollect
+		case c == 0x5b:
+			return StateCsiEntry, ActionClear
+		case c == 0x50:
+			return StateDcsEntry, ActionClear
+		case c == 0x5d:
+			return StateOscString, ActionOscStart
+		case c == 0x58, c == 0x5e, c == 0x5f:
+			return StateSosPmApcString, ActionNone
+		case
+			c == 0x59,
+			c == 0x5a,
+			c == 0x5c,
+			isBetween(c, 0x30, 0x4f),
+			isBetween(c, 0x51, 0x57),
+			isBetween(c, 0x60, 0x7e):
+			return StateGround, ActionEscDispatch
+		}
+
+	case StateEscapeIntermediate:
+		switch {
+		case c == 0x7f:
+			return StateEscapeIntermediate, ActionIgnore
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateEscapeIntermediate, ActionExecute
+		case isBetween(c, 0x20, 0x2f):
+			return StateEscapeIntermediate, ActionCollect
+
+		case isBetween(c, 0x30, 0x7e):
+			return StateGround, ActionEscDispatch
+		}
+
+	case StateCsiEntry:
+		switch {
+		case c == 0x7f:
+			return StateCsiEntry, ActionIgnore
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateCsiEntry, ActionExecute
+
+		case isBetween(c, 0x20, 0x2f):
+			return StateCsiIntermediate, ActionCollect
+		case isBetween(c, 0x30, 0x3b):
+			return StateCsiParam, ActionParam
+		case isBetween(c, 0x3c, 0x3f):
+			return StateCsiParam, ActionCollect
+		case isBetween(c, 0x40, 0x7e):
+			return StateGround, ActionCsiDispatch
+		}
+	case StateCsiIgnore:
+		switch {
+		case
+			c == 0x7f,
+			isBetween(c, 0x20, 0x3f):
+			return StateCsiIgnore, ActionIgnore
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateCsiIgnore, ActionExecute
+
+		case isBetween(c, 0x40, 0x7e):
+			return StateGround, ActionNone
+		}
+	case StateCsiIntermediate:
+		switch {
+		case c == 0x7f:
+			return StateCsiIntermediate, ActionIgnore
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateCsiIntermediate, ActionExecute
+		case isBetween(c, 0x20, 0x2f):
+			return StateCsiIntermediate, ActionCollect
+
+		case isBetween(c, 0x40, 0x7e):
+			return StateGround, ActionCsiDispatch
+		}
+	case StateCsiParam:
+		switch {
+
+		case c == 0x7f:
+			return StateCsiParam, ActionIgnore
+		case
+			c == 0x19,
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x00, 0x17):
+			return StateCsiParam, ActionExecute
+		case isBetween(c, 0x30, 0x3b):
+			return StateCsiParam, ActionParam
+		case isBetween(c, 0x3c, 0x3f):
+			return StateCsiIgnore, ActionNone
+
+		case isBetween(c, 0x20, 0x2f):
+			return StateCsiIntermediate, ActionCollect
+		case isBetween(c, 0x40, 0x7e):
+			return StateGround, ActionCsiDispatch
+		}
+	case StateOscString:
+		switch {
+		case c == 0x07:
+			return StateGround, ActionOscEnd
+		case
+			c == 0x19,
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x1c, 0x1f):
+			return StateOscString, ActionIgnore
+		case isBetween(c, 0x20, 0x7f):
+			return StateOscString, ActionOscPut
+		}
+	case StateDcsEntry:
+		switch {
+		case
+			c == 0x7f,
+			c == 0x19,
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x1c, 0x1f):
+			return StateDcsEntry, ActionIgnore
+
+		case isBetween(c, 0x20, 0x2f):
+			return StateDcsIntermediate, ActionCollect
+		case isBetween(c, 0x30, 0x3b):
+			return StateDcsParam, ActionParam
+		case isBetween(c, 0x3c, 0x3f):
+			return StateDcsParam, ActionCollect
+		case isBetween(c, 0x40, 0x7e):
+			return StateDcsPassthrough, ActionHook
+
+		}
+	case StateDcsIgnore:
+		switch {
+		case
+			c == 0x19,
+			isBetween(c, 0x20, 0x7f),
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x1c, 0x1f):
+			return StateDcsIgnore, ActionIgnore
+
+		}
+
+	case StateDcsParam:
+		switch {
+		case
+			c == 0x7f, c == 0x19,
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x1c, 0x1f):
+			return StateDcsParam, ActionIgnore
+		case isBetween(c, 0x30, 0x3b):
+			return StateDcsParam, ActionParam
+		case isBetween(c, 0x3c, 0x3f):
+			return StateDcsIgnore, ActionNone
+		case isBetween(c, 0x20, 0x2f):
+			return StateDcsIntermediate, ActionCollect
+		case isBetween(c, 0x40, 0x7e):
+			return StateDcsPassthrough, ActionHook
+		}
+	case StateDcsIntermediate:
+		switch {
+		case
+			c == 0x7f, c == 0x19,
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x1c, 0x1f):
+			return StateDcsIntermediate, ActionIgnore
+		case isBetween(c, 0x20, 0x2f):
+			return StateDcsIntermediate, ActionCollect
+
+		case isBetween(c, 0x30, 0x3f):
+			return StateDcsIgnore, ActionNone
+		case isBetween(c, 0x40, 0x7e):
+			return StateDcsPassthrough, ActionHook
+		}
+	case StateDcsPassthrough:
+		switch {
+		case c == 0x7f:
+			return StateDcsPassthrough, ActionIgnore
+		case
+			c == 0x19,
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x20, 0x7e),
+			isBetween(c, 0x1c, 0x1f):
+			return StateDcsPassthrough, ActionPut
+		}
+	case StateSosPmApcString:
+		switch {
+		case
+			c == 0x19,
+			isBetween(c, 0x00, 0x17),
+			isBetween(c, 0x1c, 0x1f),
+			isBetween(c, 0x20, 0x7f):
+			return StateSosPmApcString, ActionPut
+		}
+	}
+
+	// anywhere
+	switch {
+	case
+		c == 0x18, c == 0x1a,
+		isBetween(c, 0x80, 0x8f),
+		isBetween(c, 0x91, 0x97),
+		isBetween(c, 0x99, 0x9A):
+		return StateGround, ActionExecute
+	case c == 0x1b:
+		return StateEscape, ActionClear
+	case c == 0x9b:
+		return StateCsiEntry, ActionClear
+	case c == 0x9d:
+		return StateOscString, ActionOscStart
+	case c == 0x98, c == 0x9e, c == 0x9f:
+		return StateSosPmApcString, ActionNone
+	case c == 0x90:
+		return StateDcsEntry, ActionClear
+	case c == 0x9c:
+		// ST, the string states dispatch on leave
+		return StateGround, ActionNone
+	}
+
+	return state, ActionNone
+}
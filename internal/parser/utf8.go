@@ -0,0 +1,76 @@
+package parser
+
+import "unicode/utf8"
+
+type utf8Status int
+
+const (
+	utf8Pending utf8Status = iota
+	utf8Done
+	// the sequence was malformed, the caller emits U+FFFD and feeds the byte again
+	utf8Invalid
+)
+
+// utf8Decoder assembles runes one byte at a time. Malformed input is
+// replaced the way the WHATWG decoder does it: each maximal invalid
+// subpart becomes one U+FFFD.
+type utf8Decoder struct {
+	r      rune
+	need   int
+	lo, hi byte
+}
+
+func (d *utf8Decoder) pending() bool {
+	return d.need > 0
+}
+
+func (d *utf8Decoder) reset() {
+	d.r, d.need, d.lo, d.hi = 0, 0, 0x80, 0xbf
+}
+
+func (d *utf8Decoder) decode(c byte) (rune, utf8Status) {
+	if d.need == 0 {
+		d.lo, d.hi = 0x80, 0xbf
+
+		switch {
+		case c < 0x80:
+			return rune(c), utf8Done
+		case isBetween(c, 0xc2, 0xdf):
+			d.need, d.r = 1, rune(c&0x1f)
+		case isBetween(c, 0xe0, 0xef):
+			d.need, d.r = 2, rune(c&0x0f)
+			if c == 0xe0 {
+				d.lo = 0xa0
+			} else if c == 0xed {
+				d.hi = 0x9f
+			}
+		case isBetween(c, 0xf0, 0xf4):
+			d.need, d.r = 3, rune(c&0x07)
+			if c == 0xf0 {
+				d.lo = 0x90
+			} else if c == 0xf4 {
+				d.hi = 0x8f
+			}
+		default:
+			// a stray continuation byte or a lead byte that can never be valid
+			return utf8.RuneError, utf8Done
+		}
+		return 0, utf8Pending
+	}
+
+	if !isBetween(c, d.lo, d.hi) {
+		d.reset()
+		return utf8.RuneError, utf8Invalid
+	}
+
+	d.lo, d.hi = 0x80, 0xbf
+	d.r = d.r<<6 | rune(c&0x3f)
+	d.need--
+	if d.need > 0 {
+		return 0, utf8Pending
+	}
+
+	r := d.r
+	d.reset()
+	return r, utf8Done
+}
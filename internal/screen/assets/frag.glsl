@@ -3,24 +3,102 @@
 in vec2 uv;
 in vec3 fg;
 in vec3 bg;
+in vec2 cell; // position inside the cell, 0,0 is the top left corner
+flat in int flags;
 
 out vec4 FragColor;
 
 uniform sampler2D fontAtlas;
 uniform float pixelRange; // SDF pixel range (typically 4.0-8.0)
 uniform vec2 atlasSize; // Atlas texture dimensions
+uniform vec2 cellSize; // cell size in pixels
+uniform float italicSkew; // horizontal shift of the top of an italic glyph, in cells
+uniform int blinkOn;
 
-void main() {
-    float sdf = texture(fontAtlas, uv).r;
-    // float alpha = pow(sdf, 5.0);
-    float distance = sdf - 0.5;
-    distance *= pixelRange;
+// these match the flag constants in render.go
+const int BOLD = 1;
+const int ITALIC = 2;
+const int BLINK = 4;
+const int STRIKE = 8;
+const int OVERLINE = 16;
+const int UNDERLINE_SHIFT = 5;
+
+const int UNDERLINE_SINGLE = 1;
+const int UNDERLINE_DOUBLE = 2;
+const int UNDERLINE_CURLY = 3;
+const int UNDERLINE_DOTTED = 4;
+const int UNDERLINE_DASHED = 5;
 
+const float PI = 3.14159265;
+
+float glyph() {
+    // derivatives are taken before any branching, they are undefined otherwise
     vec2 unitRange = pixelRange / atlasSize;
     vec2 screenTexSize = vec2(1.0) / fwidth(uv);
     float screenPxRange = max(0.5 * dot(unitRange, screenTexSize), 1.0);
+    float uvPerCell = dFdx(uv.x) / dFdx(cell.x);
+
+    vec2 at = uv;
+    if ((flags & ITALIC) != 0) {
+        // shear the glyph inside its cell, the top leans right
+        float shift = italicSkew * (1.0 - cell.y);
+        if (cell.x - shift < 0.0 || cell.x - shift > 1.0) {
+            return 0.0;
+        }
+        at.x -= shift * uvPerCell;
+    }
+
+    float sdf = textureLod(fontAtlas, at, 0.0).r;
+    // bold thickens the glyph by moving the edge outwards
+    float edge = (flags & BOLD) != 0 ? 0.4 : 0.5;
+    float distance = sdf - edge;
+    distance *= pixelRange;
+
+    return clamp(distance * screenPxRange + 0.5, 0.0, 1.0);
+}
+
+// band is 1 when y, in pixels from the top of the cell, lies in [from, from+thickness).
+float band(float y, float from, float thickness) {
+    return step(from, y) * (1.0 - step(from + thickness, y));
+}
+
+float underline(int style, vec2 px, float thickness) {
+    float bottom = cellSize.y - 2.0 * thickness;
+    switch (style) {
+    case UNDERLINE_SINGLE:
+        return band(px.y, bottom, thickness);
+    case UNDERLINE_DOUBLE:
+        return max(band(px.y, bottom - 2.0 * thickness, thickness), band(px.y, bottom, thickness));
+    case UNDERLINE_CURLY: {
+        float wave = bottom - thickness + sin(px.x / cellSize.x * 2.0 * PI) * thickness;
+        return band(px.y, wave, thickness * 1.5);
+    }
+    case UNDERLINE_DOTTED:
+        return band(px.y, bottom, thickness) * step(mod(px.x, 2.0 * thickness), thickness);
+    case UNDERLINE_DASHED:
+        return band(px.y, bottom, thickness) * step(mod(px.x, cellSize.x / 2.0), cellSize.x * 0.35);
+    }
+    return 0.0;
+}
+
+void main() {
+    float alpha = glyph();
+    if ((flags & BLINK) != 0 && blinkOn == 0) {
+        FragColor = vec4(bg, 1.0);
+        return;
+    }
+
+    vec2 px = cell * cellSize;
+    float thickness = max(1.0, floor(cellSize.y / 14.0));
+
+    alpha = max(alpha, underline(flags >> UNDERLINE_SHIFT, px, thickness));
+    if ((flags & STRIKE) != 0) {
+        alpha = max(alpha, band(px.y, floor(cellSize.y * 0.55), thickness));
+    }
+    if ((flags & OVERLINE) != 0) {
+        alpha = max(alpha, band(px.y, 0.0, thickness));
+    }
 
-    float alpha = clamp(distance * screenPxRange + 0.5, 0.0, 1.0);
     vec3 color = mix(bg, fg, alpha);
     FragColor = vec4(color, 1.0);
 }
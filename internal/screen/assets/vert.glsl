@@ -4,10 +4,14 @@ layout(location = 0) in vec3 aPos;
 layout(location = 1) in vec2 aUV;
 layout(location = 2) in vec3 aFg;
 layout(location = 3) in vec3 aBg;
+layout(location = 4) in vec2 aCell;
+layout(location = 5) in float aFlags;
 
 out vec3 fg;
 out vec3 bg;
 out vec2 uv;
+out vec2 cell;
+flat out int flags;
 
  
 
@@ -18,4 +22,6 @@ void main() {
     fg = aFg;
     uv = aUV;
     bg = aBg;
+    cell = aCell;
+    flags = int(aFlags + 0.5);
 }
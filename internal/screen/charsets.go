@@ -0,0 +1,90 @@
+package screen
+
+// Charset is a character set designated to one of G0 to G3, it replaces
+// some of the printable ASCII characters.
+type Charset uint8
+
+const (
+	CharsetASCII Charset = iota
+	// CharsetUK has a pound sign in place of the number sign
+	CharsetUK
+	// CharsetDECSpecial is DEC Special Graphics, the line drawing set
+	CharsetDECSpecial
+)
+
+// decSpecialGraphics maps 0x5f to 0x7e in DEC Special Graphics.
+var decSpecialGraphics = [...]rune{
+	' ', '◆', '▒', '␉', '␌', '␍', '␊', '°', '±', '␤', '␋', '┘', '┐', '┌', '└', '┼',
+	'⎺', '⎻', '─', '⎼', '⎽', '├', '┤', '┴', '┬', '│', '≤', '≥', 'π', '≠', '£', '·',
+}
+
+func (c Charset) translate(r rune) rune {
+	switch c {
+	case CharsetUK:
+		if r == '#' {
+			return '£'
+		}
+	case CharsetDECSpecial:
+		if r >= 0x5f && r <= 0x7e {
+			return decSpecialGraphics[r-0x5f]
+		}
+	}
+	return r
+}
+
+// charsetFor returns the set an SCS final byte designates.
+func charsetFor(final byte) (Charset, bool) {
+	switch final {
+	case 'B':
+		return CharsetASCII, true
+	case 'A':
+		return CharsetUK, true
+	case '0':
+		return CharsetDECSpecial, true
+	}
+	return 0, false
+}
+
+// charsets is the state of G0 to G3 and the shifts between them, it is
+// saved and restored with the cursor.
+type charsets struct {
+	g [4]Charset
+	// gl is the set invoked into GL by SO, SI, LS2 and LS3
+	gl int
+	// single is the set SS2 or SS3 invoke for the next character only, -1
+	// when there is none
+	single int
+}
+
+func defaultCharsets() charsets {
+	return charsets{single: -1}
+}
+
+// designate implements SCS, ESC ( ) * + pick the set for G0 to G3.
+func (self *charsets) designate(intermediate, final byte) {
+	set, ok := charsetFor(final)
+	if !ok {
+		return
+	}
+	switch intermediate {
+	case '(':
+		self.g[0] = set
+	case ')':
+		self.g[1] = set
+	case '*':
+		self.g[2] = set
+	case '+':
+		self.g[3] = set
+	}
+}
+
+// translate maps a printed character through the set in GL, or the single
+// shifted one which it uses up.
+func (self *charsets) translate(r rune) rune {
+	set := self.g[self.gl]
+	if self.single >= 0 {
+		set = self.g[self.single]
+		self.single = -1
+	}
+	return set.translate(r)
+}
@@ -0,0 +1,377 @@
+package screen
+
+// lineAt returns the cells of a row of the active screen, which always
+// sits at the bottom of the lines, below the scrollback.
+func (self *Grid) lineAt(row int) []Cell {
+	return self.rowAt(row).cells
+}
+
+func (self *Grid) rowAt(row int) *line {
+	return self.lines.at(self.historyLen() + row)
+}
+
+func (self *Grid) setCell(cell *Cell, c Cell) {
+	dirty := cell.dirty
+	*cell = c
+	cell.dirty = dirty
+	self.markDirty(cell)
+}
+
+func (self *Grid) fill(cells []Cell, blank Cell) {
+	for i := range cells {
+		self.setCell(&cells[i], blank)
+	}
+}
+
+// clearLine blanks a row of the screen, it no longer continues on the next one.
+func (self *Grid) clearLine(row int, blank Cell) {
+	l := self.rowAt(row)
+	self.fill(l.cells, blank)
+	l.wrapped = false
+}
+
+func (self *Grid) isEmpty() bool {
+	return self.Size.Rows == 0 || self.Size.Cols == 0
+}
+
+// Print writes c at the cursor and advances it. In the last column the
+// cursor stays put with a wrap pending, the next character wraps to the next
+// line unless autowrap is off and overwrites the column instead. A wide
+// character takes the cell on its right as well, when only the last column
+// is left it wraps first.
+func (self *Grid) Print(c Cell) {
+	if self.isEmpty() {
+		return
+	}
+	cols := self.Size.Cols
+	if c.Width == CellWide && cols < 2 {
+		c.Width = CellNarrow
+	}
+	n := 1
+	if c.Width == CellWide {
+		n = 2
+	}
+
+	pos := self.Cursor.Pos
+	if self.Cursor.wrapPending {
+		self.wrap(blankOf(c))
+	}
+	if n == 2 && pos.Col == cols-1 {
+		if self.modes.Get(ModeAutowrap) {
+			// the padding is a nul so reflow can tell it from text
+			line := self.lineAt(pos.Row)
+			self.breakWide(line, pos.Col)
+			self.setCell(&line[pos.Col], Cell{Fg: c.Fg, Bg: c.Bg})
+			self.wrap(blankOf(c))
+		} else {
+			pos.Col--
+		}
+	}
+	if self.modes.Get(ModeInsert) {
+		self.InsertChars(n, blankOf(c))
+	}
+
+	line := self.lineAt(pos.Row)
+	self.breakWide(line, pos.Col)
+	self.setCell(&line[pos.Col], c)
+	if n == 2 {
+		self.breakWide(line, pos.Col+1)
+		self.setCell(&line[pos.Col+1], spacerOf(c))
+	}
+	self.advance(n)
+}
+
+// advance moves the cursor right over n printed columns, at the right
+// margin it stays on the last one with a wrap pending.
+func (self *Grid) advance(n int) {
+	pos := self.Cursor.Pos
+	pos.Col += n
+	if pos.Col >= self.Size.Cols {
+		pos.Col = self.Size.Cols - 1
+		self.Cursor.wrapPending = self.modes.Get(ModeAutowrap)
+	}
+}
+
+// Combine adds r to the grapheme cluster last printed when it belongs there,
+// a flag or VS16 widen the cluster if the next cell is free to take. It
+// reports whether r was taken.
+func (self *Grid) Combine(r rune) bool {
+	if self.isEmpty() {
+		return false
+	}
+
+	pos := self.Cursor.Pos
+	col := pos.Col - 1
+	if self.Cursor.wrapPending {
+		col = pos.Col
+	}
+	if col < 0 {
+		return false
+	}
+	line := self.lineAt(pos.Row)
+	if line[col].Width == CellSpacer && col > 0 {
+		col--
+	}
+	if !extendsCluster(&line[col], r) {
+		return false
+	}
+
+	c := line[col]
+	c.Cluster = c.Text() + string(r)
+	widen := c.Width == CellNarrow && widensCluster(r) &&
+		!self.Cursor.wrapPending && pos.Col == col+1
+	if widen {
+		c.Width = CellWide
+	}
+	self.setCell(&line[col], c)
+
+	if widen {
+		self.breakWide(line, col+1)
+		self.setCell(&line[col+1], spacerOf(c))
+		self.advance(1)
+	}
+	return true
+}
+
+func (self *Grid) wrap(blank Cell) {
+	self.rowAt(self.Cursor.Pos.Row).wrapped = true
+	self.CarriageReturn()
+	self.LineFeed(blank)
+}
+
+// breakWide blanks the other half of the wide character at col, which is
+// about to be overwritten.
+func (self *Grid) breakWide(line []Cell, col int) {
+	switch line[col].Width {
+	case CellWide:
+		if col+1 < len(line) {
+			self.setCell(&line[col+1], blankOf(line[col+1]))
+		}
+	case CellSpacer:
+		if col > 0 {
+			self.setCell(&line[col-1], blankOf(line[col-1]))
+		}
+	}
+}
+
+// spacerOf is the right half of the wide character c.
+func spacerOf(c Cell) Cell {
+	return Cell{Rune: ' ', Width: CellSpacer, Fg: c.Fg, Bg: c.Bg, Attrs: c.Attrs, Underline: c.Underline}
+}
+
+func blankOf(c Cell) Cell {
+	return Cell{Rune: ' ', Fg: c.Fg, Bg: c.Bg}
+}
+
+func (self *Grid) MoveCursor(row, col int) {
+	self.Cursor.Pos.Row = clamp(row, 0, self.Size.Rows-1)
+	self.Cursor.Pos.Col = clamp(col, 0, self.Size.Cols-1)
+	self.Cursor.wrapPending = false
+}
+
+// SetCursor implements CUP, in origin mode row 0 is the top margin and the
+// cursor cannot leave the scroll region.
+func (self *Grid) SetCursor(row, col int) {
+	if self.modes.Get(ModeOrigin) {
+		row = clamp(row+self.top, self.top, self.bottom)
+	}
+	self.MoveCursor(row, col)
+}
+
+// CursorRow is the row CPR reports, relative to the top margin in origin mode.
+func (self *Grid) CursorRow() int {
+	if self.modes.Get(ModeOrigin) {
+		return self.Cursor.Pos.Row - self.top
+	}
+	return self.Cursor.Pos.Row
+}
+
+// CursorUp implements CUU, a cursor inside the scroll region stops at its
+// top margin.
+func (self *Grid) CursorUp(n int) {
+	row, top := self.Cursor.Pos.Row, 0
+	if row >= self.top {
+		top = self.top
+	}
+	self.MoveCursor(max(row-n, top), self.Cursor.Pos.Col)
+}
+
+// CursorDown implements CUD, a cursor inside the scroll region stops at its
+// bottom margin.
+func (self *Grid) CursorDown(n int) {
+	row, bottom := self.Cursor.Pos.Row, self.Size.Rows-1
+	if row <= self.bottom {
+		bottom = self.bottom
+	}
+	self.MoveCursor(min(row+n, bottom), self.Cursor.Pos.Col)
+}
+
+func (self *Grid) MoveCursorBy(rows, cols int) {
+	self.MoveCursor(self.Cursor.Pos.Row+rows, self.Cursor.Pos.Col+cols)
+}
+
+func (self *Grid) CarriageReturn() {
+	self.Cursor.Pos.Col = 0
+	self.Cursor.wrapPending = false
+}
+
+func (self *Grid) Backspace() {
+	if self.Cursor.Pos.Col > 0 {
+		self.MoveCursorBy(0, -1)
+	}
+}
+
+// LineFeed moves the cursor down, at the bottom margin the scroll region
+// scrolls up instead and the line scrolled in is filled with blank.
+func (self *Grid) LineFeed(blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	self.Cursor.wrapPending = false
+	switch row := self.Cursor.Pos.Row; {
+	case row == self.bottom:
+		self.ScrollUp(1, blank)
+	case row < self.Size.Rows-1:
+		self.Cursor.Pos.Row++
+	}
+}
+
+// ReverseLineFeed moves the cursor up, at the top margin the scroll region
+// scrolls down instead and the line scrolled in is filled with blank.
+func (self *Grid) ReverseLineFeed(blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	self.Cursor.wrapPending = false
+	switch row := self.Cursor.Pos.Row; {
+	case row == self.top:
+		self.ScrollDown(1, blank)
+	case row > 0:
+		self.Cursor.Pos.Row--
+	}
+}
+
+// EraseInDisplay implements ED, 0: cursor to end, 1: start to cursor,
+// 2: whole screen, 3: scrollback.
+func (self *Grid) EraseInDisplay(mode int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	row := self.Cursor.Pos.Row
+	switch mode {
+	case 0:
+		self.EraseInLine(0, blank)
+		for r := row + 1; r < self.Size.Rows; r++ {
+			self.clearLine(r, blank)
+		}
+	case 1:
+		for r := 0; r < row; r++ {
+			self.clearLine(r, blank)
+		}
+		self.EraseInLine(1, blank)
+	case 2:
+		for r := 0; r < self.Size.Rows; r++ {
+			self.clearLine(r, blank)
+		}
+	case 3:
+		self.lines.dropOldest(self.historyLen())
+		self.ResetViewOffset()
+		self.markAllDirty()
+	}
+}
+
+// EraseInLine implements EL, 0: cursor to end, 1: start to cursor, 2: whole line.
+func (self *Grid) EraseInLine(mode int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	row := self.Cursor.Pos.Row
+	line := self.lineAt(row)
+	col := self.Cursor.Pos.Col
+	self.Cursor.wrapPending = false
+	switch mode {
+	case 0:
+		self.erase(line, col, len(line), blank)
+		self.rowAt(row).wrapped = false
+	case 1:
+		self.erase(line, 0, col+1, blank)
+	case 2:
+		self.clearLine(row, blank)
+	}
+}
+
+// EraseChars implements ECH, blanking n cells from the cursor without moving it.
+func (self *Grid) EraseChars(n int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	line := self.lineAt(self.Cursor.Pos.Row)
+	col := self.Cursor.Pos.Col
+	self.Cursor.wrapPending = false
+	self.erase(line, col, min(col+n, len(line)), blank)
+}
+
+// InsertChars implements ICH, n blanks are inserted at the cursor and the
+// cells pushed past the right margin are lost.
+func (self *Grid) InsertChars(n int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	line := self.lineAt(self.Cursor.Pos.Row)
+	col := self.Cursor.Pos.Col
+	n = min(n, len(line)-col)
+	self.Cursor.wrapPending = false
+	if line[col].Width == CellSpacer {
+		self.breakWide(line, col)
+	}
+	for i := len(line) - 1; i >= col+n; i-- {
+		self.setCell(&line[i], line[i-n])
+	}
+	if last := &line[len(line)-1]; last.Width == CellWide {
+		// its right half was pushed out
+		self.setCell(last, blankOf(*last))
+	}
+	self.fill(line[col:col+n], blank)
+}
+
+// DeleteChars implements DCH, n cells are removed at the cursor and the rest
+// of the line shifts left, blanks fill in at the right margin.
+func (self *Grid) DeleteChars(n int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+
+	line := self.lineAt(self.Cursor.Pos.Row)
+	col := self.Cursor.Pos.Col
+	n = min(n, len(line)-col)
+	self.Cursor.wrapPending = false
+	self.breakWide(line, col)
+	self.breakWide(line, col+n-1)
+	for i := col; i < len(line)-n; i++ {
+		self.setCell(&line[i], line[i+n])
+	}
+	self.fill(line[len(line)-n:], blank)
+}
+
+// erase blanks line[from:to] along with the halves of wide characters cut
+// at either end.
+func (self *Grid) erase(line []Cell, from, to int, blank Cell) {
+	if from >= to {
+		return
+	}
+	self.breakWide(line, from)
+	self.breakWide(line, to-1)
+	self.fill(line[from:to], blank)
+}
+
+func (self *Grid) markAllDirty() {
+	self.GetView(GridIterAll, func(row, col int, cell *Cell) {
+		self.markDirty(cell)
+	})
+}
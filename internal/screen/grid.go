@@ -4,27 +4,58 @@ import (
 	"image/color"
 )
 
+var (
+	defaultFg color.Color = DefaultForeground
+	defaultBg color.Color = DefaultBackground
+)
+
 type Grid struct {
-	Bg         color.Color
-	Size       *GSize
-	Cursor     *Cursor
-	Cells      []Cell
+	Bg     color.Color
+	Size   *GSize
+	Cursor *Cursor
+	// lines is the scrollback followed by the screen
+	lines      *ring
+	limit      ScrollbackLimit
 	viewOffset int
 	CellSize   *Size
+	// top and bottom are the scroll region margins, DECSTBM
+	top, bottom int
+	// modes is the screen's mode table, shared by both buffers
+	modes *Modes
+	// tabs marks the columns with a tab stop
+	tabs []bool
+	// noScrollback drops the lines scrolled off the top, for the alternate screen
+	noScrollback bool
 
 	dirtyCount int
 }
 
 type Cell struct {
-	Rune  rune
-	Fg    color.Color
-	Bg    color.Color
-	dirty bool
+	Rune rune
+	// Cluster is the whole grapheme cluster when Rune carries combining
+	// marks, joined characters or selectors, empty otherwise
+	Cluster   string
+	Width     CellWidth
+	Fg        color.Color
+	Bg        color.Color
+	Attrs     Attr
+	Underline UnderlineStyle
+	dirty     bool
+}
+
+// Text returns the characters the cell shows.
+func (c Cell) Text() string {
+	if c.Cluster != "" {
+		return c.Cluster
+	}
+	return string(c.Rune)
 }
 
 type Cursor struct {
-	Pos    *GPos
-	Hidden bool
+	Pos *GPos
+	// wrapPending is set once a character is printed in the last column, the
+	// cursor stays on it and the next character goes to the next line
+	wrapPending bool
 }
 
 type Size struct {
@@ -49,48 +80,74 @@ const (
 	GridIterDirty
 )
 
-func newGrid() *Grid {
+func newGrid(modes *Modes) *Grid {
 
 	cursor := &Cursor{
-		Hidden: false,
 		Pos: &GPos{
 			Col: 0,
 			Row: 0,
 		}}
 
 	return &Grid{
-		Bg:         color.Black,
+		Bg:         defaultBg,
 		Cursor:     cursor,
+		modes:      modes,
+		lines:      newRing(0),
 		viewOffset: 0,
 		CellSize:   &Size{Height: 10, Width: 10},
 		Size:       &GSize{Cols: 0, Rows: 0},
 	}
 }
 
-func (self *Grid) Resize(windowWidth, windowHeight int32, blockWidth, blockHeight int32) {
+func newAlternateGrid(modes *Modes) *Grid {
+	grid := newGrid(modes)
+	grid.noScrollback = true
+	return grid
+}
 
-	self.Size.Rows = int(windowHeight) / int(blockHeight)
-	self.Size.Cols = int(windowWidth) / int(blockWidth)
+func (self *Grid) Resize(windowWidth, windowHeight int32, blockWidth, blockHeight int32) {
 	self.CellSize = &Size{Height: int(blockHeight), Width: int(blockWidth)}
+	self.resize(int(windowHeight)/int(blockHeight), int(windowWidth)/int(blockWidth))
+}
 
-	ct := len(self.Cells)
-	nt := self.Size.Cols * self.Size.Rows
+func (self *Grid) resize(rows, cols int) {
+	if rows <= 0 || cols <= 0 {
+		// nothing fits, keep the lines for when the window grows again
+		self.Size.Rows, self.Size.Cols = max(rows, 0), max(cols, 0)
+		return
+	}
 
-	if ct < nt {
-		self.Cells = append(self.Cells, make([]Cell, nt-ct)...)
-		for i := range self.Cells {
-			self.Cells[i] = Cell{
-				Bg:   color.White,
-				Fg:   color.Black,
-				Rune: 'A',
-			}
-		}
+	if self.noScrollback {
+		self.clip(rows, cols)
+	} else {
+		self.reflow(rows, cols)
 	}
+	self.resizeTabs(cols)
 
-	self.GetView(GridIterAll, func(row, col int, cell *Cell) {
-		self.markDirty(cell)
-	})
+	self.ResetViewOffset()
+	self.resetMargins()
+	self.MoveCursor(self.Cursor.Pos.Row, self.Cursor.Pos.Col)
+	self.markAllDirty()
+}
 
+// SetScrollbackLimit caps the history, the oldest lines past the limit are dropped.
+func (self *Grid) SetScrollbackLimit(limit ScrollbackLimit) {
+	self.limit = limit
+	self.lines.setMax(self.maxHistory() + self.Size.Rows)
+	self.ResetViewOffset()
+	self.markAllDirty()
+}
+
+func (self *Grid) maxHistory() int {
+	if self.noScrollback {
+		return 0
+	}
+	return self.limit.lines(self.Size.Cols)
+}
+
+// historyLen is the number of lines in the scrollback.
+func (self *Grid) historyLen() int {
+	return max(self.lines.len()-self.Size.Rows, 0)
 }
 
 func (self *Grid) IsClean() bool {
@@ -99,7 +156,9 @@ func (self *Grid) IsClean() bool {
 }
 
 func (self *Grid) markDirty(cell *Cell) {
-	self.dirtyCount = +1
+	if !cell.dirty {
+		self.dirtyCount += 1
+	}
 	cell.dirty = true
 }
 func (self *Grid) markClean(cell *Cell) {
@@ -110,32 +169,35 @@ func (self *Grid) markClean(cell *Cell) {
 	cell.dirty = false
 }
 
-func (self *Grid) getBuffer() []Cell {
-	return self.Cells[self.viewOffset*self.Size.Cols : (self.viewOffset*self.Size.Cols)+(self.Size.Cols*self.Size.Rows)]
-}
-
 func (self *Grid) GetView(mode ViewMode, cbl func(x int, y int, cell *Cell)) {
-	buff := self.getBuffer()
-
-	for i := range buff {
-		cell := &buff[i]
-		if !cell.dirty && mode == GridIterDirty {
-			continue
-		}
+	if self.isEmpty() {
+		return
+	}
 
-		y := int(i / self.Size.Cols)
-		x := i % self.Size.Cols
+	for y := range self.Size.Rows {
+		line := self.viewLine(y)
+		for x := range line {
+			cell := &line[x]
+			if !cell.dirty && mode == GridIterDirty {
+				continue
+			}
 
-		cbl(x, y, cell)
+			cbl(x, y, cell)
 
-		if mode == GridIterDirty {
-			self.markClean(cell)
+			if mode == GridIterDirty {
+				self.markClean(cell)
+			}
 		}
 	}
 }
 
+// viewLine is the y-th line on screen, from the scrollback when scrolled back.
+func (self *Grid) viewLine(y int) []Cell {
+	return self.lines.at(self.viewOffset + y).cells
+}
+
 func (self *Grid) getDefaultViewOffset() int {
-	return (len(self.Cells) / self.Size.Cols) - self.Size.Rows
+	return self.historyLen()
 }
 
 func (self *Grid) ResetViewOffset() {
@@ -155,4 +217,5 @@ func (self *Grid) Scroll(o int) {
 	} else {
 		self.viewOffset += o
 	}
+	self.markAllDirty()
 }
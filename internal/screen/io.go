@@ -1,11 +1,300 @@
 package screen
 
-import "github.com/moozd/goofed/internal/parser"
+import (
+	"github.com/moozd/goofed/internal/encoder"
+	"github.com/moozd/goofed/internal/parser"
+)
 
-func (self *Screen) handle(event parser.ParserEvent) {
+// Screen is the parser's Performer, the callbacks run inside feed which
+// holds the lock.
+func (self *Screen) Print(text []rune) {
+	for _, r := range text {
+		self.print(r)
+	}
+}
+
+func (self *Screen) print(r rune) {
+	if r == 0x7f {
+		return
+	}
+	r = self.charsets.translate(r)
+	if self.grid.Combine(r) {
+		return
+	}
+
+	w := runeWidth(r)
+	if w == 0 {
+		// a mark with no character to attach to
+		return
+	}
+
+	c := self.pen
+	c.Rune = r
+	if w == 2 {
+		c.Width = CellWide
+	}
+	self.grid.Print(c)
+	self.last = r
+}
+
+func (self *Screen) Execute(c byte) {
+	switch c {
+	case 0x07: // BEL, there is no bell yet
+	case 0x08:
+		self.grid.Backspace()
+	case 0x09:
+		self.grid.TabForward(1)
+	case 0x0a, 0x0b, 0x0c:
+		self.grid.LineFeed(self.blank())
+		if self.modes.Get(ModeLineFeed) {
+			self.grid.CarriageReturn()
+		}
+	case 0x0d:
+		self.grid.CarriageReturn()
+	case 0x0e: // SO
+		self.charsets.gl = 1
+	case 0x0f: // SI
+		self.charsets.gl = 0
+	}
+}
+
+func (self *Screen) CsiDispatch(params *parser.Params, intermediates []byte, final byte) {
+	fn := parser.IdentifyCsi(params, intermediates, final)
+	grid := self.grid
+	pos := grid.Cursor.Pos
+
+	switch fn.ID {
+	case parser.FnCUU:
+		grid.CursorUp(fn.Arg(0))
+	case parser.FnCUD:
+		grid.CursorDown(fn.Arg(0))
+	case parser.FnCUF:
+		grid.MoveCursorBy(0, fn.Arg(0))
+	case parser.FnCUB:
+		grid.MoveCursorBy(0, -fn.Arg(0))
+	case parser.FnCNL:
+		grid.CursorDown(fn.Arg(0))
+		grid.CarriageReturn()
+	case parser.FnCPL:
+		grid.CursorUp(fn.Arg(0))
+		grid.CarriageReturn()
+	case parser.FnCHA, parser.FnHPA:
+		grid.MoveCursor(pos.Row, fn.Arg(0)-1)
+	case parser.FnHPR:
+		grid.MoveCursorBy(0, fn.Arg(0))
+	case parser.FnVPR:
+		grid.MoveCursorBy(fn.Arg(0), 0)
+	case parser.FnCUP, parser.FnHVP:
+		grid.SetCursor(fn.Arg(0)-1, fn.Arg(1)-1)
+	case parser.FnVPA:
+		grid.SetCursor(fn.Arg(0)-1, pos.Col)
+	case parser.FnED:
+		grid.EraseInDisplay(fn.Arg(0), self.blank())
+	case parser.FnEL:
+		grid.EraseInLine(fn.Arg(0), self.blank())
+	case parser.FnECH:
+		grid.EraseChars(fn.Arg(0), self.blank())
+	case parser.FnICH:
+		grid.InsertChars(fn.Arg(0), self.blank())
+	case parser.FnDCH:
+		grid.DeleteChars(fn.Arg(0), self.blank())
+	case parser.FnREP:
+		if self.last != 0 {
+			for range min(fn.Arg(0), grid.Size.Rows*grid.Size.Cols) {
+				self.print(self.last)
+			}
+		}
+	case parser.FnIL:
+		grid.InsertLines(fn.Arg(0), self.blank())
+	case parser.FnDL:
+		grid.DeleteLines(fn.Arg(0), self.blank())
+	case parser.FnSU:
+		grid.ScrollUp(fn.Arg(0), self.blank())
+	case parser.FnSD:
+		grid.ScrollDown(fn.Arg(0), self.blank())
+	case parser.FnDECSTBM:
+		top, bottom := fn.Arg(0), fn.Arg(1)
+		if top == 0 {
+			top = 1
+		}
+		if bottom == 0 {
+			bottom = grid.Size.Rows
+		}
+		if grid.SetMargins(top-1, bottom-1) {
+			grid.SetCursor(0, 0)
+		}
+	case parser.FnSM, parser.FnRM:
+		for i := range params.Len() {
+			self.setMode(params.Get(i, 0), false, fn.ID == parser.FnSM)
+		}
+	case parser.FnDECSET, parser.FnDECRST:
+		for i := range params.Len() {
+			self.setMode(params.Get(i, 0), true, fn.ID == parser.FnDECSET)
+		}
+	case parser.FnXTMODKEYS:
+		if fn.Arg(0) == 4 {
+			self.modifyOtherKeys = clamp(params.Get(1, 0), 0, 2)
+		}
+	case parser.FnKittyKeyboardPush:
+		self.pushKeyboardFlags(encoder.KittyFlags(fn.Arg(0)))
+	case parser.FnKittyKeyboardPop:
+		self.popKeyboardFlags(fn.Arg(0))
+	case parser.FnKittyKeyboardSet:
+		self.setKeyboardFlags(encoder.KittyFlags(fn.Arg(0)), fn.Arg(1))
+	case parser.FnKittyKeyboardQuery:
+		self.reply(encoder.KittyFlagsReport(currentFlags(self.keyboardStack)))
+	case parser.FnXTSAVE:
+		for i := range params.Len() {
+			self.saveMode(params.Get(i, 0))
+		}
+	case parser.FnXTRESTORE:
+		for i := range params.Len() {
+			self.restoreMode(params.Get(i, 0))
+		}
+	case parser.FnCHT:
+		grid.TabForward(fn.Arg(0))
+	case parser.FnCBT:
+		grid.TabBackward(fn.Arg(0))
+	case parser.FnTBC:
+		grid.ClearTabStop(fn.Arg(0))
+	case parser.FnSGR:
+		self.sgr(params)
+	case parser.FnDSR, parser.FnDECDSR:
+		self.reportStatus(fn.Arg(0), fn.ID == parser.FnDECDSR)
+	case parser.FnDA1:
+		self.reportDeviceAttributes(1)
+	case parser.FnDA2:
+		self.reportDeviceAttributes(2)
+	case parser.FnDA3:
+		self.reportDeviceAttributes(3)
+	case parser.FnXTVERSION:
+		self.reportVersion()
+	case parser.FnDECRQM, parser.FnDECRQMPrivate:
+		self.reportMode(fn.Arg(0), fn.ID == parser.FnDECRQMPrivate)
+	}
+}
+
+func (self *Screen) EscDispatch(intermediates []byte, final byte) {
+	fn := parser.IdentifyEsc(intermediates, final)
+
+	switch fn.ID {
+	case parser.FnDECSC:
+		self.saveCursor()
+	case parser.FnDECRC:
+		self.restoreCursor()
+	case parser.FnIND:
+		self.grid.LineFeed(self.blank())
+	case parser.FnNEL:
+		self.grid.CarriageReturn()
+		self.grid.LineFeed(self.blank())
+	case parser.FnRI:
+		self.grid.ReverseLineFeed(self.blank())
+	case parser.FnHTS:
+		self.grid.SetTabStop()
+	case parser.FnSCS:
+		self.charsets.designate(intermediates[0], final)
+	case parser.FnLS2:
+		self.charsets.gl = 2
+	case parser.FnLS3:
+		self.charsets.gl = 3
+	case parser.FnSS2:
+		self.charsets.single = 2
+	case parser.FnSS3:
+		self.charsets.single = 3
+	case parser.FnDECKPAM, parser.FnDECKPNM:
+		self.modes.Set(ModeApplicationKeypad, fn.ID == parser.FnDECKPAM)
+	case parser.FnRIS:
+		self.useAlternate(false)
+		self.pen = defaultPen()
+		self.saved, self.inactiveSaved = nil, nil
+		self.charsets = defaultCharsets()
+		self.modes.Reset()
+		self.modifyOtherKeys = 0
+		self.keyboardStack, self.inactiveKeyboardStack = nil, nil
+		self.last = 0
+		self.grid.EraseInDisplay(3, self.blank())
+		self.grid.EraseInDisplay(2, self.blank())
+		self.grid.resetMargins()
+		self.grid.resetTabs()
+		self.grid.MoveCursor(0, 0)
+	}
+}
+
+func (self *Screen) Hook(params *parser.Params, intermediates []byte, final byte) {}
+
+func (self *Screen) Put(c byte) {}
+
+func (self *Screen) Unhook() {}
+
+func (self *Screen) OscDispatch(payload []byte, bell, truncated bool) {
+	if truncated {
+		return
+	}
+	fn := parser.IdentifyOsc(payload)
+
+	switch fn.ID {
+	case parser.FnOscSetColor:
+		self.setPaletteColors(fn, bell)
+	case parser.FnOscForeground, parser.FnOscBackground, parser.FnOscCursorColor:
+		self.setDefaultColors(fn, bell)
+	case parser.FnOscResetColor:
+		self.resetPaletteColors(fn)
+	case parser.FnOscResetForeground:
+		self.resetDefaultColor(DefaultForeground)
+	case parser.FnOscResetBackground:
+		self.resetDefaultColor(DefaultBackground)
+	case parser.FnOscResetCursorColor:
+		self.resetDefaultColor(DefaultCursor)
+	}
+}
+
+func (self *Screen) SosPmApcDispatch(kind parser.StringKind, payload []byte, truncated bool) {}
+
+func (self *Screen) saveCursor() {
+	self.saved = &savedCursor{
+		pos:         *self.grid.Cursor.Pos,
+		pen:         self.pen,
+		wrapPending: self.grid.Cursor.wrapPending,
+		origin:      self.modes.Get(ModeOrigin),
+		charsets:    self.charsets,
+	}
+}
+
+// restoreCursor implements DECRC, without a saved state the cursor goes home
+// and the pen, origin mode and character sets are reset.
+func (self *Screen) restoreCursor() {
+	if self.saved == nil {
+		self.modes.Set(ModeOrigin, false)
+		self.grid.MoveCursor(0, 0)
+		self.pen = defaultPen()
+		self.charsets = defaultCharsets()
+		return
+	}
+	self.modes.Set(ModeOrigin, self.saved.origin)
+	self.grid.MoveCursor(self.saved.pos.Row, self.saved.pos.Col)
+	self.grid.Cursor.wrapPending = self.saved.wrapPending
+	self.pen = self.saved.pen
+	self.charsets = self.saved.charsets
+}
+
+// blank is an erased cell, it keeps the current background (BCE).
+func (self *Screen) blank() Cell {
+	return Cell{Rune: ' ', Fg: self.pen.Fg, Bg: self.pen.Bg}
+}
 
+// reply queues an answer to the program, every reply is built by the encoder
+// package. It runs inside feed, which writes the queue once the lock is
+// released, so a program that does not read its input can't block parsing.
+func (self *Screen) reply(seq []byte) {
+	self.pending = append(self.pending, seq...)
 }
 
-func (self *Screen) send(b ...byte) {
-	self.session.Write(b)
+// send writes to the program, input and flushed replies one write at a time.
+func (self *Screen) send(seq []byte) {
+	if self.replies == nil || len(seq) == 0 {
+		return
+	}
+	self.writeMu.Lock()
+	defer self.writeMu.Unlock()
+	self.replies.Write(seq)
 }
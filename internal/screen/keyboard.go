@@ -0,0 +1,310 @@
+package screen
+
+import (
+	"unicode"
+
+	"github.com/moozd/goofed/internal/encoder"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// keyboardStackSize bounds the kitty keyboard flags stack of each buffer, the
+// oldest entries are dropped when a push overflows it.
+const keyboardStackSize = 16
+
+// sdlKeys are the keys that do not type text, or not only text.
+var sdlKeys = map[sdl.Keycode]encoder.Key{
+	sdl.K_UP:          encoder.KeyUp,
+	sdl.K_DOWN:        encoder.KeyDown,
+	sdl.K_RIGHT:       encoder.KeyRight,
+	sdl.K_LEFT:        encoder.KeyLeft,
+	sdl.K_HOME:        encoder.KeyHome,
+	sdl.K_END:         encoder.KeyEnd,
+	sdl.K_INSERT:      encoder.KeyInsert,
+	sdl.K_DELETE:      encoder.KeyDelete,
+	sdl.K_PAGEUP:      encoder.KeyPageUp,
+	sdl.K_PAGEDOWN:    encoder.KeyPageDown,
+	sdl.K_F1:          encoder.KeyF1,
+	sdl.K_F2:          encoder.KeyF2,
+	sdl.K_F3:          encoder.KeyF3,
+	sdl.K_F4:          encoder.KeyF4,
+	sdl.K_F5:          encoder.KeyF5,
+	sdl.K_F6:          encoder.KeyF6,
+	sdl.K_F7:          encoder.KeyF7,
+	sdl.K_F8:          encoder.KeyF8,
+	sdl.K_F9:          encoder.KeyF9,
+	sdl.K_F10:         encoder.KeyF10,
+	sdl.K_F11:         encoder.KeyF11,
+	sdl.K_F12:         encoder.KeyF12,
+	sdl.K_RETURN:      encoder.KeyEnter,
+	sdl.K_TAB:         encoder.KeyTab,
+	sdl.K_BACKSPACE:   encoder.KeyBackspace,
+	sdl.K_ESCAPE:      encoder.KeyEscape,
+	sdl.K_KP_0:        encoder.KeyKP0,
+	sdl.K_KP_1:        encoder.KeyKP1,
+	sdl.K_KP_2:        encoder.KeyKP2,
+	sdl.K_KP_3:        encoder.KeyKP3,
+	sdl.K_KP_4:        encoder.KeyKP4,
+	sdl.K_KP_5:        encoder.KeyKP5,
+	sdl.K_KP_6:        encoder.KeyKP6,
+	sdl.K_KP_7:        encoder.KeyKP7,
+	sdl.K_KP_8:        encoder.KeyKP8,
+	sdl.K_KP_9:        encoder.KeyKP9,
+	sdl.K_KP_PERIOD:   encoder.KeyKPDecimal,
+	sdl.K_KP_DIVIDE:   encoder.KeyKPDivide,
+	sdl.K_KP_MULTIPLY: encoder.KeyKPMultiply,
+	sdl.K_KP_MINUS:    encoder.KeyKPSubtract,
+	sdl.K_KP_PLUS:     encoder.KeyKPAdd,
+	sdl.K_KP_EQUALS:   encoder.KeyKPEqual,
+	sdl.K_KP_ENTER:    encoder.KeyKPEnter,
+
+	// only the kitty protocol reports the modifier and lock keys
+	sdl.K_LSHIFT:       encoder.KeyLeftShift,
+	sdl.K_LCTRL:        encoder.KeyLeftCtrl,
+	sdl.K_LALT:         encoder.KeyLeftAlt,
+	sdl.K_LGUI:         encoder.KeyLeftSuper,
+	sdl.K_RSHIFT:       encoder.KeyRightShift,
+	sdl.K_RCTRL:        encoder.KeyRightCtrl,
+	sdl.K_RALT:         encoder.KeyRightAlt,
+	sdl.K_RGUI:         encoder.KeyRightSuper,
+	sdl.K_CAPSLOCK:     encoder.KeyCapsLock,
+	sdl.K_NUMLOCKCLEAR: encoder.KeyNumLock,
+}
+
+// sdlModifiers maps the SDL modifier state, the locks are left out as the
+// legacy encodings ignore them. Only the left Alt is Alt, the right one is
+// AltGr on many layouts and its text is typed as is.
+func sdlModifiers(mod uint16) encoder.Modifiers {
+	var mods encoder.Modifiers
+	for _, m := range []struct {
+		sdl uint16
+		mod encoder.Modifiers
+	}{
+		{sdl.KMOD_SHIFT, encoder.ModShift},
+		{sdl.KMOD_LALT, encoder.ModAlt},
+		{sdl.KMOD_CTRL, encoder.ModCtrl},
+		{sdl.KMOD_GUI, encoder.ModSuper},
+	} {
+		if mod&m.sdl != 0 {
+			mods |= m.mod
+		}
+	}
+	return mods
+}
+
+// sdlLocks maps the lock modifiers, which only the kitty protocol reports.
+func sdlLocks(mod uint16) encoder.Modifiers {
+	var mods encoder.Modifiers
+	if mod&sdl.KMOD_CAPS != 0 {
+		mods |= encoder.ModCapsLock
+	}
+	if mod&sdl.KMOD_NUM != 0 {
+		mods |= encoder.ModNumLock
+	}
+	return mods
+}
+
+// keyboard is the state kept between the key and text events SDL sends for
+// the same key press.
+type keyboard struct {
+	// suppressText drops the text of a key that was already sent
+	suppressText bool
+	// textMods are the modifiers the text of the last key is typed with
+	textMods encoder.Modifiers
+	// pending is a kitty key event waiting for its text
+	pending *encoder.KittyKey
+	flags   encoder.KittyFlags
+}
+
+// keyEvent handles a key press, repeat or release. The kitty keyboard
+// protocol encodes it when the program asked for it, the legacy encodings
+// otherwise.
+func (self *Screen) keyEvent(e *sdl.KeyboardEvent) {
+	self.flushKey()
+
+	if flags := self.keyboardFlags(); flags != 0 {
+		k, ok := kittyKey(e)
+		if ok && flags&encoder.KittyAssociatedText != 0 && flags&encoder.KittyAllKeys != 0 && typesText(k) {
+			// the text comes with the next event, or the key is sent without
+			// it once the events SDL had queued are handled
+			self.keyboard = keyboard{pending: &k, flags: flags}
+			return
+		}
+		if seq, handled := encoder.KittyKeySequence(k, flags); ok && handled {
+			self.send(seq)
+			self.keyboard = keyboard{suppressText: e.Type == sdl.KEYDOWN}
+			return
+		}
+	}
+
+	if e.Type == sdl.KEYDOWN {
+		self.keyDown(e)
+	}
+}
+
+// typesText tells whether SDL may follow a key event with the text it typed,
+// Ctrl and Super keep a key from typing.
+func typesText(k encoder.KittyKey) bool {
+	return k.Code != 0 && k.Event != encoder.KeyRelease && k.Mods&(encoder.ModCtrl|encoder.ModSuper) == 0
+}
+
+// flushKey sends the pending kitty key event, with the text typed since. The
+// render loop also calls it after every batch of SDL events, so a key whose
+// text never comes is not held back.
+func (self *Screen) flushKey() {
+	if k := self.keyboard.pending; k != nil {
+		seq, _ := encoder.KittyKeySequence(*k, self.keyboard.flags)
+		self.send(seq)
+		self.keyboard = keyboard{}
+	}
+}
+
+// kittyKey describes an SDL key event for the kitty protocol, ok is false for
+// keys it has no code for.
+func kittyKey(e *sdl.KeyboardEvent) (k encoder.KittyKey, ok bool) {
+	k.Mods = sdlModifiers(e.Keysym.Mod) | sdlLocks(e.Keysym.Mod)
+	switch {
+	case e.Type == sdl.KEYUP:
+		k.Event = encoder.KeyRelease
+	case e.Repeat != 0:
+		k.Event = encoder.KeyRepeat
+	default:
+		k.Event = encoder.KeyPress
+	}
+
+	sym := e.Keysym.Sym
+	if key, found := sdlKeys[sym]; found {
+		k.Key = key
+		return k, true
+	}
+	// the keycode of a key that types text is its unshifted character
+	if sym < ' ' || sym == 0x7f || sym > unicode.MaxRune {
+		return k, false
+	}
+	k.Code = rune(sym)
+	if k.Mods&encoder.ModShift != 0 {
+		k.Shifted = unicode.ToUpper(k.Code)
+	}
+	return k, true
+}
+
+// keyboardFlags are the kitty keyboard flags of the active buffer.
+func (self *Screen) keyboardFlags() encoder.KittyFlags {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return currentFlags(self.keyboardStack)
+}
+
+func currentFlags(stack []encoder.KittyFlags) encoder.KittyFlags {
+	if len(stack) == 0 {
+		return 0
+	}
+	return stack[len(stack)-1]
+}
+
+// pushKeyboardFlags implements CSI > flags u.
+func (self *Screen) pushKeyboardFlags(flags encoder.KittyFlags) {
+	if len(self.keyboardStack) == keyboardStackSize {
+		self.keyboardStack = self.keyboardStack[1:]
+	}
+	self.keyboardStack = append(self.keyboardStack, flags&encoder.KittyAllFlags)
+}
+
+// popKeyboardFlags implements CSI < n u, popping more than was pushed
+// empties the stack.
+func (self *Screen) popKeyboardFlags(n int) {
+	self.keyboardStack = self.keyboardStack[:max(len(self.keyboardStack)-n, 0)]
+}
+
+// setKeyboardFlags implements CSI = flags ; mode u, 1: replace the flags,
+// 2: set the bits in flags, 3: reset them.
+func (self *Screen) setKeyboardFlags(flags encoder.KittyFlags, mode int) {
+	flags &= encoder.KittyAllFlags
+	current := currentFlags(self.keyboardStack)
+	switch mode {
+	case 1:
+		current = flags
+	case 2:
+		current |= flags
+	case 3:
+		current &^= flags
+	default:
+		return
+	}
+
+	if len(self.keyboardStack) == 0 {
+		self.keyboardStack = append(self.keyboardStack, current)
+		return
+	}
+	self.keyboardStack[len(self.keyboardStack)-1] = current
+}
+
+// keyDown handles a key press. Keys without text and Ctrl combinations are
+// sent from here, everything else waits for the text SDL sends next, so the
+// keyboard layout is respected.
+func (self *Screen) keyDown(e *sdl.KeyboardEvent) {
+	mods := sdlModifiers(e.Keysym.Mod)
+	sym := e.Keysym.Sym
+	self.keyboard = keyboard{}
+
+	if key, ok := sdlKeys[sym]; ok {
+		self.keyboard.suppressText = self.pressKey(key, mods)
+		return
+	}
+
+	if mods&encoder.ModCtrl != 0 && sym >= ' ' && sym < 0x7f {
+		r := rune(sym)
+		if mods&encoder.ModShift != 0 && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		self.send(encoder.EncodeRune(r, mods, self.keyOptions()))
+		self.keyboard.suppressText = true
+		return
+	}
+	self.keyboard.textMods = mods
+}
+
+// textInput types text, with Alt from the key that produced it.
+func (self *Screen) textInput(text string) {
+	if k := self.keyboard.pending; k != nil {
+		k.Text += text
+		self.flushKey()
+		return
+	}
+	if self.keyboard.suppressText {
+		self.keyboard.suppressText = false
+		return
+	}
+	self.typeText(text, self.keyboard.textMods)
+	self.keyboard.textMods = 0
+}
+
+// pressKey sends a key that does not type text. It reports false for a
+// keypad key in numeric mode, which is left to the text input.
+func (self *Screen) pressKey(key encoder.Key, mods encoder.Modifiers) bool {
+	opts := self.keyOptions()
+	if key.IsKeypad() && key != encoder.KeyKPEnter && !opts.Keypad && mods&(encoder.ModCtrl|encoder.ModAlt) == 0 {
+		return false
+	}
+	self.send(encoder.EncodeKey(key, mods, opts))
+	return true
+}
+
+func (self *Screen) typeText(text string, mods encoder.Modifiers) {
+	opts := self.keyOptions()
+	var b []byte
+	for _, r := range text {
+		b = append(b, encoder.EncodeRune(r, mods, opts)...)
+	}
+	self.send(b)
+}
+
+// keyOptions reads the modes that change what keys send.
+func (self *Screen) keyOptions() encoder.KeyOptions {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return encoder.KeyOptions{
+		CursorKeys:      self.modes.Get(ModeCursorKeys),
+		Keypad:          self.modes.Get(ModeApplicationKeypad),
+		ModifyOtherKeys: self.modifyOtherKeys,
+	}
+}
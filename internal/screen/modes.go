@@ -0,0 +1,273 @@
+package screen
+
+import (
+	"time"
+
+	"github.com/moozd/goofed/internal/encoder"
+)
+
+// Mode is a terminal mode the screen tracks, ANSI or DEC private. Every
+// mode is described once in modeSpecs, which is what SM, RM, DECSET,
+// DECRST, XTSAVE, XTRESTORE and DECRQM go through.
+type Mode uint8
+
+const (
+	// ANSI modes
+
+	ModeInsert   Mode = iota // IRM, printing shifts the rest of the line right
+	ModeLineFeed             // LNM, LF, VT and FF also return the carriage
+
+	// DEC private modes
+
+	ModeCursorKeys          // DECCKM, the cursor keys send SS3 sequences
+	ModeOrigin              // DECOM, cursor addressing is relative to the scroll region
+	ModeAutowrap            // DECAWM, with it off the last column is overwritten
+	ModeMouseX10            // the mouse reports button presses
+	ModeCursorVisible       // DECTCEM
+	ModeAltScreen           // the alternate screen
+	ModeApplicationKeypad   // DECNKM, the keypad sends application sequences
+	ModeMouseNormal         // the mouse reports presses and releases
+	ModeMouseButton         // the mouse also reports motion with a button down
+	ModeMouseAny            // the mouse reports all motion
+	ModeFocus               // focus in and out are reported
+	ModeMouseUTF8           // mouse reports use the UTF-8 encoding
+	ModeMouseSGR            // mouse reports use the SGR encoding
+	ModeMouseURXVT          // mouse reports use the urxvt encoding
+	ModeMouseSGRPixels      // mouse reports use the SGR encoding, in pixels
+	ModeAltScreenClear      // the alternate screen, cleared when left
+	ModeSaveCursor          // DECSC on set, DECRC on reset
+	ModeAltScreenSaveCursor // the alternate screen, with the cursor saved and cleared on entry
+	ModeBracketedPaste      // pasted text is wrapped in CSI 200 ~ and CSI 201 ~
+	ModeSyncOutput          // the screen is not drawn until the update is done
+
+	modeCount
+)
+
+// modeGroup gathers modes of which only one can be set at a time.
+type modeGroup uint8
+
+const (
+	noGroup modeGroup = iota
+	mouseTracking
+	mouseEncoding
+)
+
+type modeSpec struct {
+	number  int
+	private bool
+	name    string
+	initial bool
+	group   modeGroup
+}
+
+var modeSpecs = [modeCount]modeSpec{
+	ModeInsert:              {number: 4, name: "IRM"},
+	ModeLineFeed:            {number: 20, name: "LNM"},
+	ModeCursorKeys:          {number: 1, private: true, name: "DECCKM"},
+	ModeOrigin:              {number: 6, private: true, name: "DECOM"},
+	ModeAutowrap:            {number: 7, private: true, name: "DECAWM", initial: true},
+	ModeMouseX10:            {number: 9, private: true, name: "X10_MOUSE", group: mouseTracking},
+	ModeCursorVisible:       {number: 25, private: true, name: "DECTCEM", initial: true},
+	ModeAltScreen:           {number: 47, private: true, name: "ALT_SCREEN"},
+	ModeApplicationKeypad:   {number: 66, private: true, name: "DECNKM"},
+	ModeMouseNormal:         {number: 1000, private: true, name: "NORMAL_MOUSE", group: mouseTracking},
+	ModeMouseButton:         {number: 1002, private: true, name: "BUTTON_MOUSE", group: mouseTracking},
+	ModeMouseAny:            {number: 1003, private: true, name: "ANY_MOUSE", group: mouseTracking},
+	ModeFocus:               {number: 1004, private: true, name: "FOCUS_EVENTS"},
+	ModeMouseUTF8:           {number: 1005, private: true, name: "UTF8_MOUSE", group: mouseEncoding},
+	ModeMouseSGR:            {number: 1006, private: true, name: "SGR_MOUSE", group: mouseEncoding},
+	ModeMouseURXVT:          {number: 1015, private: true, name: "URXVT_MOUSE", group: mouseEncoding},
+	ModeMouseSGRPixels:      {number: 1016, private: true, name: "SGR_PIXEL_MOUSE", group: mouseEncoding},
+	ModeAltScreenClear:      {number: 1047, private: true, name: "ALT_SCREEN_CLEAR"},
+	ModeSaveCursor:          {number: 1048, private: true, name: "SAVE_CURSOR"},
+	ModeAltScreenSaveCursor: {number: 1049, private: true, name: "ALT_SCREEN_SAVE_CURSOR"},
+	ModeBracketedPaste:      {number: 2004, private: true, name: "BRACKETED_PASTE"},
+	ModeSyncOutput:          {number: 2026, private: true, name: "SYNC_OUTPUT"},
+}
+
+type modeKey struct {
+	number  int
+	private bool
+}
+
+var modesByNumber = func() map[modeKey]Mode {
+	m := make(map[modeKey]Mode, modeCount)
+	for mode, s := range modeSpecs {
+		m[modeKey{s.number, s.private}] = Mode(mode)
+	}
+	return m
+}()
+
+// LookupMode finds the mode SM and RM (private false) or DECSET and DECRST
+// (private true) call number, ok is false for the modes goofed does not support.
+func LookupMode(number int, private bool) (mode Mode, ok bool) {
+	mode, ok = modesByNumber[modeKey{number, private}]
+	return
+}
+
+func (mode Mode) Number() int {
+	return modeSpecs[mode].number
+}
+
+func (mode Mode) Private() bool {
+	return modeSpecs[mode].private
+}
+
+func (mode Mode) String() string {
+	return modeSpecs[mode].name
+}
+
+// Modes holds the state of every mode, along with the values XTSAVE stored.
+type Modes struct {
+	on    [modeCount]bool
+	saved [modeCount]bool
+}
+
+func NewModes() *Modes {
+	m := &Modes{}
+	m.Reset()
+	return m
+}
+
+// Reset puts every mode back to its initial value and forgets the saved ones.
+func (m *Modes) Reset() {
+	for mode, s := range modeSpecs {
+		m.on[mode] = s.initial
+		m.saved[mode] = s.initial
+	}
+}
+
+func (m *Modes) Get(mode Mode) bool {
+	return m.on[mode]
+}
+
+// Set switches a mode, setting one of a group resets the others.
+func (m *Modes) Set(mode Mode, on bool) {
+	if group := modeSpecs[mode].group; on && group != noGroup {
+		for other, s := range modeSpecs {
+			if s.group == group {
+				m.on[other] = false
+			}
+		}
+	}
+	m.on[mode] = on
+}
+
+// Save implements XTSAVE for a single mode.
+func (m *Modes) Save(mode Mode) {
+	m.saved[mode] = m.on[mode]
+}
+
+// Saved is the value XTRESTORE brings back, the initial one if the mode was
+// never saved.
+func (m *Modes) Saved(mode Mode) bool {
+	return m.saved[mode]
+}
+
+// State answers DECRQM.
+func (m *Modes) State(number int, private bool) encoder.ModeState {
+	mode, ok := LookupMode(number, private)
+	switch {
+	case !ok:
+		return encoder.ModeNotRecognized
+	case m.Get(mode):
+		return encoder.ModeSet
+	}
+	return encoder.ModeReset
+}
+
+// setMode implements SM, RM, DECSET and DECRST for a single mode, along with
+// what switching it does beyond the mode table.
+func (self *Screen) setMode(number int, private bool, on bool) {
+	mode, ok := LookupMode(number, private)
+	if !ok {
+		return
+	}
+
+	switch mode {
+	case ModeOrigin:
+		self.modes.Set(mode, on)
+		self.grid.SetCursor(0, 0)
+	case ModeAutowrap:
+		self.modes.Set(mode, on)
+		if !on {
+			self.grid.Cursor.wrapPending = false
+		}
+	case ModeAltScreen:
+		self.useAlternate(on)
+	case ModeAltScreenClear:
+		if !on && self.grid == self.alternate {
+			self.grid.EraseInDisplay(2, self.blank())
+		}
+		self.useAlternate(on)
+	case ModeSaveCursor:
+		self.modes.Set(mode, on)
+		if on {
+			self.saveCursor()
+		} else {
+			self.restoreCursor()
+		}
+	case ModeAltScreenSaveCursor:
+		// the cursor is saved in the primary buffer before switching, and
+		// restored from it after switching back
+		if on {
+			if self.grid == self.alternate {
+				return
+			}
+			self.saveCursor()
+			self.useAlternate(true)
+			self.grid.EraseInDisplay(2, self.blank())
+		} else {
+			self.useAlternate(false)
+			self.restoreCursor()
+		}
+	case ModeSyncOutput:
+		if on && !self.modes.Get(mode) {
+			self.syncStart = time.Now()
+		}
+		self.modes.Set(mode, on)
+	default:
+		self.modes.Set(mode, on)
+	}
+}
+
+// saveMode implements XTSAVE for a single DEC private mode.
+func (self *Screen) saveMode(number int) {
+	if mode, ok := LookupMode(number, true); ok {
+		self.modes.Save(mode)
+	}
+}
+
+// restoreMode implements XTRESTORE for a single DEC private mode.
+func (self *Screen) restoreMode(number int) {
+	if mode, ok := LookupMode(number, true); ok {
+		self.setMode(number, true, self.modes.Saved(mode))
+	}
+}
+
+// useAlternate switches between the primary and the alternate buffer. The
+// cursor keeps its position, each buffer keeps its own DECSC state and kitty
+// keyboard flags.
+func (self *Screen) useAlternate(on bool) {
+	next := self.primary
+	if on {
+		next = self.alternate
+	}
+	if next == self.grid {
+		return
+	}
+
+	*next.Cursor.Pos = *self.grid.Cursor.Pos
+	next.MoveCursor(next.Cursor.Pos.Row, next.Cursor.Pos.Col)
+	next.Cursor.wrapPending = self.grid.Cursor.wrapPending
+	self.saved, self.inactiveSaved = self.inactiveSaved, self.saved
+	self.keyboardStack, self.inactiveKeyboardStack = self.inactiveKeyboardStack, self.keyboardStack
+	self.grid = next
+	next.ResetViewOffset()
+	next.markAllDirty()
+
+	// every way in reports the alternate screen as active
+	for _, mode := range []Mode{ModeAltScreen, ModeAltScreenClear, ModeAltScreenSaveCursor} {
+		self.modes.Set(mode, on)
+	}
+}
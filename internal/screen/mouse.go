@@ -0,0 +1,151 @@
+package screen
+
+import (
+	"github.com/moozd/goofed/internal/encoder"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// sdlButtons maps the SDL mouse buttons to the buttons of a mouse report.
+var sdlButtons = map[uint8]encoder.MouseButton{
+	sdl.BUTTON_LEFT:   encoder.MouseLeft,
+	sdl.BUTTON_MIDDLE: encoder.MouseMiddle,
+	sdl.BUTTON_RIGHT:  encoder.MouseRight,
+	sdl.BUTTON_X1:     encoder.MouseButton8,
+	sdl.BUTTON_X2:     encoder.MouseButton9,
+}
+
+// mouse is the pointer state kept between SDL mouse events.
+type mouse struct {
+	// x, y is the last pointer position in window pixels, for the wheel
+	x, y int32
+	// held are the buttons down, left, middle and right
+	held [3]bool
+	// reported is where the last report was, motion within it is not sent
+	reported GPos
+}
+
+// button is the held button motion is reported with, MouseRelease for none.
+func (m *mouse) button() encoder.MouseButton {
+	for b, down := range m.held {
+		if down {
+			return encoder.MouseButton(b)
+		}
+	}
+	return encoder.MouseRelease
+}
+
+// mouseModifiers are the modifiers held, SDL mouse events do not carry them.
+func mouseModifiers() encoder.Modifiers {
+	return sdlModifiers(uint16(sdl.GetModState()))
+}
+
+func (self *Screen) mouseButton(e *sdl.MouseButtonEvent) {
+	button, ok := sdlButtons[e.Button]
+	if !ok {
+		return
+	}
+	self.mouseEvent(encoder.MouseEvent{
+		Button:  button,
+		Mods:    mouseModifiers(),
+		Release: e.Type == sdl.MOUSEBUTTONUP,
+	}, e.X, e.Y)
+}
+
+func (self *Screen) mouseMotion(e *sdl.MouseMotionEvent) {
+	self.mouseEvent(encoder.MouseEvent{
+		Button: self.mouse.button(),
+		Mods:   mouseModifiers(),
+		Motion: true,
+	}, e.X, e.Y)
+}
+
+// mouseWheel reports every notch the wheel turned as a press of a wheel
+// button, at the last pointer position.
+func (self *Screen) mouseWheel(e *sdl.MouseWheelEvent) {
+	dx, dy := e.X, e.Y
+	if e.Direction == sdl.MOUSEWHEEL_FLIPPED {
+		dx, dy = -dx, -dy
+	}
+
+	mods := mouseModifiers()
+	notches := func(n int32, positive, negative encoder.MouseButton) {
+		button := positive
+		if n < 0 {
+			n, button = -n, negative
+		}
+		for range n {
+			self.mouseEvent(encoder.MouseEvent{Button: button, Mods: mods}, self.mouse.x, self.mouse.y)
+		}
+	}
+	notches(dy, encoder.MouseWheelUp, encoder.MouseWheelDown)
+	notches(dx, encoder.MouseWheelRight, encoder.MouseWheelLeft)
+}
+
+// mouseEvent reports a mouse event at x, y in window pixels to the program,
+// if it enabled mouse tracking. Shift keeps the mouse to the terminal, so
+// text can still be selected in programs that track it.
+func (self *Screen) mouseEvent(e encoder.MouseEvent, x, y int32) {
+	m := &self.mouse
+	m.x, m.y = x, y
+	if !e.Motion && e.Button <= encoder.MouseRight {
+		m.held[e.Button] = !e.Release
+	}
+	if e.Mods&encoder.ModShift != 0 {
+		return
+	}
+
+	self.mu.Lock()
+	seq := self.encodeMouse(e, x, y)
+	self.mu.Unlock()
+	self.send(seq)
+}
+
+// encodeMouse encodes a mouse event the way the mouse modes ask for, nil when
+// they do not ask for it.
+func (self *Screen) encodeMouse(e encoder.MouseEvent, x, y int32) []byte {
+	modes := self.modes
+	switch {
+	case modes.Get(ModeMouseX10):
+		// presses only, without modifiers
+		if e.Motion || e.Release {
+			return nil
+		}
+		e.Mods = 0
+	case modes.Get(ModeMouseNormal):
+		if e.Motion {
+			return nil
+		}
+	case modes.Get(ModeMouseButton):
+		if e.Motion && e.Button == encoder.MouseRelease {
+			return nil
+		}
+	case modes.Get(ModeMouseAny):
+	default:
+		return nil
+	}
+
+	// cells and pixels are both counted from 1
+	grid := self.grid
+	col := clamp(int(x)/grid.CellSize.Width, 0, grid.Size.Cols-1)
+	row := clamp(int(y)/grid.CellSize.Height, 0, grid.Size.Rows-1)
+	pos := GPos{Row: row + 1, Col: col + 1}
+	if modes.Get(ModeMouseSGRPixels) {
+		pos.Col = clamp(int(x), 0, grid.Size.Cols*grid.CellSize.Width-1) + 1
+		pos.Row = clamp(int(y), 0, grid.Size.Rows*grid.CellSize.Height-1) + 1
+	}
+	if e.Motion && pos == self.mouse.reported {
+		return nil
+	}
+	self.mouse.reported = pos
+	e.Row, e.Col = pos.Row, pos.Col
+
+	switch {
+	case modes.Get(ModeMouseSGR), modes.Get(ModeMouseSGRPixels):
+		return encoder.MouseSGR(e)
+	case modes.Get(ModeMouseURXVT):
+		return encoder.MouseURXVT(e)
+	case modes.Get(ModeMouseUTF8):
+		return encoder.MouseUTF8(e)
+	}
+	return encoder.MouseX10(e)
+}
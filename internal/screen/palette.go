@@ -0,0 +1,262 @@
+package screen
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/moozd/goofed/internal/encoder"
+	"github.com/moozd/goofed/internal/parser"
+)
+
+// IndexedColor is an entry of the 256 colour palette. Cells keep the index
+// and not its value, so changing the palette with OSC 4 recolours the text
+// that is already on the screen.
+type IndexedColor uint8
+
+// RGBA resolves the index against the xterm defaults, the screen resolves it
+// against its own palette when drawing.
+func (c IndexedColor) RGBA() (r, g, b, a uint32) {
+	return xtermColors[c].RGBA()
+}
+
+// DefaultColor is the default foreground or background, set with OSC 10 and 11.
+type DefaultColor uint8
+
+const (
+	DefaultForeground DefaultColor = iota
+	DefaultBackground
+	DefaultCursor
+	defaultColorCount
+)
+
+func (c DefaultColor) RGBA() (r, g, b, a uint32) {
+	return xtermDefaults[c].RGBA()
+}
+
+// xtermBase are the xterm defaults for the 16 ANSI colours.
+var xtermBase = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xff},
+	{0xcd, 0x00, 0x00, 0xff},
+	{0x00, 0xcd, 0x00, 0xff},
+	{0xcd, 0xcd, 0x00, 0xff},
+	{0x00, 0x00, 0xee, 0xff},
+	{0xcd, 0x00, 0xcd, 0xff},
+	{0x00, 0xcd, 0xcd, 0xff},
+	{0xe5, 0xe5, 0xe5, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff},
+	{0xff, 0x00, 0x00, 0xff},
+	{0x00, 0xff, 0x00, 0xff},
+	{0xff, 0xff, 0x00, 0xff},
+	{0x5c, 0x5c, 0xff, 0xff},
+	{0xff, 0x00, 0xff, 0xff},
+	{0x00, 0xff, 0xff, 0xff},
+	{0xff, 0xff, 0xff, 0xff},
+}
+
+var xtermDefaults = [defaultColorCount]color.RGBA{
+	DefaultForeground: {0xff, 0xff, 0xff, 0xff},
+	DefaultBackground: {0x00, 0x00, 0x00, 0xff},
+	DefaultCursor:     {0xff, 0xff, 0xff, 0xff},
+}
+
+var xtermColors = buildColors(xtermBase)
+
+// buildColors extends the 16 base colours with the 6x6x6 colour cube and
+// the 24 step grey ramp.
+func buildColors(base [16]color.RGBA) [256]color.RGBA {
+	var colors [256]color.RGBA
+	copy(colors[:], base[:])
+
+	level := func(n int) uint8 {
+		if n == 0 {
+			return 0
+		}
+		return uint8(55 + n*40)
+	}
+	for i := range 216 {
+		colors[16+i] = color.RGBA{level(i / 36), level(i / 6 % 6), level(i % 6), 0xff}
+	}
+	for i := range 24 {
+		v := uint8(8 + i*10)
+		colors[232+i] = color.RGBA{v, v, v, 0xff}
+	}
+	return colors
+}
+
+// Palette resolves the colours of cells. Programs change it with OSC
+// sequences, resetting an entry brings back the configured value.
+type Palette struct {
+	colors   [256]color.RGBA
+	defaults [defaultColorCount]color.RGBA
+
+	initialColors   [256]color.RGBA
+	initialDefaults [defaultColorCount]color.RGBA
+}
+
+// NewPalette creates a palette from the 16 base colours and the default
+// foreground, background and cursor colours.
+func NewPalette(base [16]color.RGBA, fg, bg, cursor color.RGBA) *Palette {
+	p := &Palette{
+		initialColors:   buildColors(base),
+		initialDefaults: [defaultColorCount]color.RGBA{fg, bg, cursor},
+	}
+	p.Reset()
+	return p
+}
+
+// DefaultPalette is the xterm palette, white on black.
+func DefaultPalette() *Palette {
+	return NewPalette(xtermBase, xtermDefaults[DefaultForeground], xtermDefaults[DefaultBackground], xtermDefaults[DefaultCursor])
+}
+
+func (p *Palette) Reset() {
+	p.colors = p.initialColors
+	p.defaults = p.initialDefaults
+}
+
+// Resolve turns a cell colour into the colour to draw.
+func (p *Palette) Resolve(c color.Color) color.RGBA {
+	switch c := c.(type) {
+	case IndexedColor:
+		return p.colors[c]
+	case DefaultColor:
+		return p.defaults[c]
+	case color.RGBA:
+		return c
+	case nil:
+		return p.defaults[DefaultForeground]
+	}
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func (p *Palette) Color(i int) color.RGBA {
+	return p.colors[i]
+}
+
+func (p *Palette) SetColor(i int, c color.RGBA) {
+	p.colors[i] = c
+}
+
+func (p *Palette) ResetColor(i int) {
+	p.colors[i] = p.initialColors[i]
+}
+
+func (p *Palette) Default(d DefaultColor) color.RGBA {
+	return p.defaults[d]
+}
+
+func (p *Palette) SetDefault(d DefaultColor, c color.RGBA) {
+	p.defaults[d] = c
+}
+
+func (p *Palette) ResetDefault(d DefaultColor) {
+	p.defaults[d] = p.initialDefaults[d]
+}
+
+// parseColorSpec reads the XParseColor formats programs use with OSC 4 and
+// 10-12: rgb:r/g/b with 1 to 4 hex digits per channel, and #rgb with 1 to 4
+// digits per channel.
+func parseColorSpec(spec string) (color.RGBA, bool) {
+	var channels []string
+
+	switch {
+	case strings.HasPrefix(spec, "rgb:"):
+		channels = strings.Split(spec[4:], "/")
+		if len(channels) != 3 {
+			return color.RGBA{}, false
+		}
+	case strings.HasPrefix(spec, "#"):
+		digits := spec[1:]
+		n := len(digits) / 3
+		if n == 0 || n > 4 || len(digits)%3 != 0 {
+			return color.RGBA{}, false
+		}
+		channels = []string{digits[:n], digits[n : 2*n], digits[2*n:]}
+	default:
+		return color.RGBA{}, false
+	}
+
+	var rgb [3]uint8
+	for i, ch := range channels {
+		if len(ch) == 0 || len(ch) > 4 {
+			return color.RGBA{}, false
+		}
+		v, err := strconv.ParseUint(ch, 16, 16)
+		if err != nil {
+			return color.RGBA{}, false
+		}
+		// scale to 8 bits, 1 digit f is as bright as 4 digits ffff
+		maxValue := uint64(1)<<(4*len(ch)) - 1
+		rgb[i] = uint8((v*0xff + maxValue/2) / maxValue)
+	}
+	return color.RGBA{rgb[0], rgb[1], rgb[2], 0xff}, true
+}
+
+// setPaletteColors implements OSC 4, a list of index;spec pairs where a
+// spec of ? asks for the current colour.
+func (self *Screen) setPaletteColors(fn parser.Function, bell bool) {
+	for i := 0; ; i += 2 {
+		index, spec := fn.Field(i), fn.Field(i+1)
+		if index == nil || spec == nil {
+			return
+		}
+		n, err := strconv.Atoi(string(index))
+		if err != nil || n < 0 || n > 255 {
+			continue
+		}
+
+		if string(spec) == "?" {
+			self.reportColor(fn.Code, []string{string(index)}, self.palette.Color(n), bell)
+		} else if c, ok := parseColorSpec(string(spec)); ok {
+			self.palette.SetColor(n, c)
+			self.grid.markAllDirty()
+		}
+	}
+}
+
+// setDefaultColors implements OSC 10, 11 and 12. Like xterm, more specs
+// after the first one set the colours that follow, so OSC 10;fg;bg sets both.
+func (self *Screen) setDefaultColors(fn parser.Function, bell bool) {
+	first := DefaultColor(fn.Code - 10)
+	for i := 0; first+DefaultColor(i) < defaultColorCount; i++ {
+		spec := fn.Field(i)
+		if spec == nil {
+			return
+		}
+		d := first + DefaultColor(i)
+
+		if string(spec) == "?" {
+			self.reportColor(fn.Code+i, nil, self.palette.Default(d), bell)
+		} else if c, ok := parseColorSpec(string(spec)); ok {
+			self.palette.SetDefault(d, c)
+			self.grid.markAllDirty()
+		}
+	}
+}
+
+// resetPaletteColors implements OSC 104, without indexes every entry is reset.
+func (self *Screen) resetPaletteColors(fn parser.Function) {
+	if len(fn.Payload) == 0 {
+		for i := range 256 {
+			self.palette.ResetColor(i)
+		}
+	}
+	for i := 0; fn.Field(i) != nil; i++ {
+		if n, err := strconv.Atoi(string(fn.Field(i))); err == nil && n >= 0 && n <= 255 {
+			self.palette.ResetColor(n)
+		}
+	}
+	self.grid.markAllDirty()
+}
+
+func (self *Screen) resetDefaultColor(d DefaultColor) {
+	self.palette.ResetDefault(d)
+	self.grid.markAllDirty()
+}
+
+// reportColor answers a colour query, terminated with BEL when the query was.
+func (self *Screen) reportColor(code int, args []string, c color.RGBA, bell bool) {
+	spec := encoder.ColorSpec(uint16(c.R)*0x101, uint16(c.G)*0x101, uint16(c.B)*0x101)
+	self.reply(encoder.ColorReport(code, args, spec, bell))
+}
@@ -0,0 +1,175 @@
+package screen
+
+// reflow fits the lines to a new size by joining the soft-wrapped lines
+// back into paragraphs and wrapping those again at the new width, the
+// scrollback included. The cursor stays on the character it was on.
+//
+// Blank lines below the cursor are dropped, so a taller window pulls lines
+// out of the scrollback and a shorter one only pushes lines into it when the
+// text needs the room. Only lines above the cursor go to the scrollback, the
+// lines below it that no longer fit are dropped.
+func (self *Grid) reflow(rows, cols int) {
+	pos := self.Cursor.Pos
+	cursorLine := self.historyLen() + pos.Row
+
+	var paragraphs [][]Cell
+	var current []Cell
+	cursorParagraph, cursorOffset := -1, 0
+
+	for i := range self.lines.len() {
+		l := self.lines.at(i)
+		if i == cursorLine {
+			cursorParagraph = len(paragraphs)
+			cursorOffset = len(current) + pos.Col
+			if self.Cursor.wrapPending {
+				cursorOffset++
+			}
+		}
+		cells := l.cells
+		if l.wrapped && len(cells) > 0 && cells[len(cells)-1].Rune == 0 {
+			// the padding left by a wide character wrapped early
+			cells = cells[:len(cells)-1]
+		}
+		current = append(current, cells...)
+		if !l.wrapped || i == self.lines.len()-1 {
+			paragraphs = append(paragraphs, current)
+			current = nil
+		}
+	}
+
+	var lines []*line
+	newCursorLine, newCursorCol := 0, 0
+	for i, p := range paragraphs {
+		p = trimBlanks(p)
+		wrapped, starts := rewrap(p, cols)
+		if i == cursorParagraph {
+			// a cursor past the text stays on its last line
+			at := len(starts) - 1
+			for at > 0 && starts[at] > cursorOffset {
+				at--
+			}
+			newCursorLine = len(lines) + at
+			newCursorCol = min(cursorOffset-starts[at], cols-1)
+		}
+		lines = append(lines, wrapped...)
+	}
+
+	last := newCursorLine
+	for i := len(lines) - 1; i > last; i-- {
+		if !isBlankLine(lines[i]) {
+			last = i
+		}
+	}
+	// the cursor's line stays on screen
+	lines = lines[:min(last+1, newCursorLine+rows, len(lines))]
+	for len(lines) < rows {
+		l := &line{cells: make([]Cell, cols)}
+		for k := range l.cells {
+			l.cells[k] = defaultPen()
+		}
+		lines = append(lines, l)
+	}
+
+	self.Size.Rows, self.Size.Cols = rows, cols
+	self.lines.max = self.maxHistory() + rows
+	self.lines.replace(lines)
+
+	pos.Row = newCursorLine - (len(lines) - rows)
+	pos.Col = newCursorCol
+}
+
+// clip fits the lines to a new size by cutting or padding each of them, for
+// the alternate screen whose programs redraw it after a resize anyway.
+func (self *Grid) clip(rows, cols int) {
+	oldRows := self.Size.Rows
+	self.Size.Rows, self.Size.Cols = rows, cols
+
+	for i := range self.lines.len() {
+		l := self.lines.at(i)
+		l.wrapped = false
+		if len(l.cells) == cols {
+			continue
+		}
+		resized := make([]Cell, cols)
+		n := copy(resized, l.cells)
+		for j := n; j < cols; j++ {
+			resized[j] = defaultPen()
+		}
+		if last := &resized[cols-1]; last.Width == CellWide {
+			// its right half was cut off
+			*last = blankOf(*last)
+		}
+		l.cells = resized
+	}
+
+	self.lines.setMax(self.maxHistory() + rows)
+	for self.lines.len() < rows {
+		l, _ := self.lines.push(cols)
+		for i := range l.cells {
+			l.cells[i] = defaultPen()
+		}
+	}
+
+	// the screen is the bottom of the lines, when it shrinks the cursor
+	// follows its line up
+	if rows < oldRows {
+		self.Cursor.Pos.Row -= oldRows - rows
+	}
+}
+
+// rewrap lays a paragraph out on lines of cols cells and returns them with
+// the offset of the first cell of each in p. A wide character cut by the
+// margin moves to the next line and leaves a nul as padding.
+func rewrap(p []Cell, cols int) (lines []*line, starts []int) {
+	start := 0
+	for {
+		end := min(start+cols, len(p))
+		if end < len(p) && end-start > 1 && p[end-1].Width == CellWide {
+			end--
+		}
+
+		l := &line{cells: make([]Cell, cols), wrapped: end < len(p)}
+		n := copy(l.cells, p[start:end])
+		for k := range n {
+			l.cells[k].dirty = false
+		}
+		for k := n; k < cols; k++ {
+			l.cells[k] = defaultPen()
+		}
+		if n < cols && l.wrapped {
+			l.cells[n] = Cell{Fg: defaultFg, Bg: defaultBg}
+		}
+
+		lines = append(lines, l)
+		starts = append(starts, start)
+		if start = end; start >= len(p) {
+			return lines, starts
+		}
+	}
+}
+
+func isBlank(c Cell) bool {
+	return (c.Rune == ' ' || c.Rune == 0) && c.Width == CellNarrow && c.Cluster == "" && c.Attrs == 0 && c.Underline == UnderlineNone && c.Bg == defaultBg
+}
+
+func isBlankLine(l *line) bool {
+	if l.wrapped {
+		return false
+	}
+	for _, c := range l.cells {
+		if !isBlank(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimBlanks drops the blank cells at the end of a paragraph, they are the
+// padding of its last line and not text.
+func trimBlanks(cells []Cell) []Cell {
+	n := len(cells)
+	for n > 0 && isBlank(cells[n-1]) {
+		n--
+	}
+	return cells[:n]
+}
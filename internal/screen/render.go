@@ -3,6 +3,7 @@ package screen
 import (
 	_ "embed"
 	"image/color"
+	"time"
 
 	"github.com/moozd/goofed/pkg/gfx"
 )
@@ -17,47 +18,98 @@ var (
 
 const FONT_ADDR = "/home/mo/.local/share/fonts/FiraCode/FiraCodeNerdFont-Regular.ttf"
 
+const (
+	// pos, uv, fg, bg, position inside the cell, flags
+	vertexSize   = 3 + 2 + 3 + 3 + 2 + 1
+	quadSize     = 4 * vertexSize
+	blinkPeriod  = 500 * time.Millisecond
+	italicSkew   = 0.2
+	faintDimming = 0.5
+	// syncTimeout bounds a synchronized update, a program that never ends
+	// one does not freeze the screen
+	syncTimeout = 150 * time.Millisecond
+)
+
+// flags tell the fragment shader how to decorate a cell, they match assets/frag.glsl.
+const (
+	flagBold = 1 << iota
+	flagItalic
+	flagBlink
+	flagStrike
+	flagOverline
+	// the underline style is stored in the bits from here
+	flagUnderlineShift = iota
+)
+
 func (self *Screen) Render() {
 	surface := gfx.NewSurface()
-	surface.SetBackground(color.RGBA{R: 0x0, G: 0x0, B: 0x0})
-
-	w, h := surface.Size()
 
 	fnt, _ := gfx.NewFont(FONT_ADDR, 14)
 	atlas := gfx.NewAtlas(fnt)
 	aw, ah := atlas.GetSize()
 
-	vertices, indices := createGrid(atlas, w, h, int(w/int32(fnt.AdvanceWidth)), int(h/int32(fnt.LineHeight)))
-
 	shader := gfx.NewShader(vertShaderSrc, fragShaderSrc)
 	shader.Use()
 	shader.SetInt("fontAtlas", atlas.TexSlotIndex())
 	shader.SetFloat("pixelRange", 4.0)
-	shader.SetVec2("vec2", float32(aw), float32(ah))
+	shader.SetVec2("atlasSize", float32(aw), float32(ah))
+	shader.SetFloat("italicSkew", italicSkew)
 
-	vao := gfx.NewVAO(gfx.F32.SizeOf(3 + 2 + 3 + 3))
+	var vertices []float32
+
+	vao := gfx.NewVAO(gfx.F32.SizeOf(vertexSize))
 	vbo := gfx.NewVBO(vertices)
-	ebo := gfx.NewEBO(indices)
+	ebo := gfx.NewEBO(nil)
 
-	vao.Define(vbo, gfx.F32, 0, 3, 0)                 // pos
-	vao.Define(vbo, gfx.F32, 1, 2, gfx.F32.SizeOf(3)) // uv
-	vao.Define(vbo, gfx.F32, 2, 3, gfx.F32.SizeOf(5)) // fg
-	vao.Define(vbo, gfx.F32, 3, 3, gfx.F32.SizeOf(8)) // bg
+	vao.Define(vbo, gfx.F32, 0, 3, 0)                  // pos
+	vao.Define(vbo, gfx.F32, 1, 2, gfx.F32.SizeOf(3))  // uv
+	vao.Define(vbo, gfx.F32, 2, 3, gfx.F32.SizeOf(5))  // fg
+	vao.Define(vbo, gfx.F32, 3, 3, gfx.F32.SizeOf(8))  // bg
+	vao.Define(vbo, gfx.F32, 4, 2, gfx.F32.SizeOf(11)) // cell
+	vao.Define(vbo, gfx.F32, 5, 1, gfx.F32.SizeOf(13)) // flags
 
 	vao.Unbind()
 	vbo.Unbind()
 	ebo.Unbind()
 
 	surface.OnResize(func(w, h int32) {
+		self.Resize(w, h, int32(fnt.AdvanceWidth), int32(fnt.LineHeight))
 		shader.Use()
 		shader.SetMat4("projection", surface.Projection)
+		shader.SetVec2("cellSize", float32(fnt.AdvanceWidth), float32(fnt.LineHeight))
 	})
 
+	surface.OnKey(self.keyEvent)
+	surface.OnTextInput(self.textInput)
+	surface.OnMouseButton(self.mouseButton)
+	surface.OnMouseMotion(self.mouseMotion)
+	surface.OnMouseWheel(self.mouseWheel)
+	surface.OnEventsHandled(self.flushKey)
+
+	start := time.Now()
 	surface.Loop(func() {
+		self.mu.Lock()
+		next, changed := vertices, false
+		if !self.synchronizing() {
+			next, changed = self.buildVertices(atlas, vertices)
+		}
+		surface.SetBackground(self.palette.Default(DefaultBackground))
+		self.mu.Unlock()
+
+		vao.Bind()
+		if len(next) != len(vertices) {
+			ebo.Update(quadIndices(len(next) / quadSize))
+		}
+		if changed {
+			vbo.Update(next)
+		}
+		vertices = next
+
 		shader.Use()
 		atlas.Compile()
+		blinkOn := time.Since(start)/blinkPeriod%2 == 0
+		shader.SetInt("blinkOn", boolToInt(blinkOn))
 
-		vao.Bind()
 		vao.Draw(ebo)
 		vao.Unbind()
 	})
@@ -70,46 +122,174 @@ func (self *Screen) Render() {
 
 }
 
-func createGrid(atlas *gfx.Atlas, ww, wh int32, m, n int) (vertices []float32, indices []uint32) {
-
-	tc := uint32(0)
-	cw := float32(ww) / float32(m)
-	ch := float32(wh) / float32(n)
-	ci := 0
-	chars := []rune{'A', 'B', 'i', 'G', '1', '2', '#', '@', '%'}
-	for y := range n {
-		for x := range m {
-
-			l := float32(x) * cw
-			r := float32(x+1) * cw
-			b := float32(y+1) * ch
-			t := float32(y) * ch
-
-			fgr, fgg, fgb := 1, 1, 1
-			bgr, bgg, bgb := 0.1, 0.1, 0.1
-
-			C := chars[ci]
-			ci = (ci + 1) % len(chars)
-			atlas.Update(C)
-			u0, v0, u1, v1 := atlas.GetUVs(C)
-
-			vertices = append(vertices, []float32{
-				// pos   // uv   // fg           												   // bg
-				l, b, 0, u0, v1, float32(fgr), float32(fgg), float32(fgb), float32(bgr), float32(bgg), float32(bgb),
-				r, b, 0, u1, v1, float32(fgr), float32(fgg), float32(fgb), float32(bgr), float32(bgg), float32(bgb),
-				l, t, 0, u0, v0, float32(fgr), float32(fgg), float32(fgb), float32(bgr), float32(bgg), float32(bgb),
-				r, t, 0, u1, v0, float32(fgr), float32(fgg), float32(fgb), float32(bgr), float32(bgg), float32(bgb),
-			}...,
-			)
-
-			indices = append(indices, []uint32{
-				tc, tc + 1, tc + 2,
-				tc + 1, tc + 2, tc + 3,
-			}...)
-			tc += 4
+// synchronizing tells whether the program is in the middle of a synchronized
+// update, the last frame stays up until it is done or syncTimeout passes.
+func (self *Screen) synchronizing() bool {
+	return self.modes.Get(ModeSyncOutput) && time.Since(self.syncStart) < syncTimeout
+}
+
+// buildVertices writes the quads of the visible cells into vertices. Only
+// dirty cells are rewritten, unless the grid changed size and every quad has
+// to be laid out again.
+func (self *Screen) buildVertices(atlas *gfx.Atlas, vertices []float32) ([]float32, bool) {
+	grid := self.grid
+	mode := GridIterDirty
+
+	if n := grid.Size.Rows * grid.Size.Cols * quadSize; n != len(vertices) {
+		vertices = make([]float32, n)
+		mode = GridIterAll
+	}
+
+	cursor := self.visibleCursor()
+	write := func(x, y int, cell *Cell) {
+		i := (y*grid.Size.Cols + x) * quadSize
+		onCursor := cursor.shown && cursor.pos == GPos{Row: y, Col: x}
+		writeQuad(vertices[i:i+quadSize], atlas, x, y, grid.CellSize, cell, self.palette, onCursor)
+	}
+
+	changed := false
+	grid.GetView(mode, func(x, y int, cell *Cell) {
+		write(x, y, cell)
+		changed = true
+	})
 
+	// the cells the cursor left and reached are redrawn even when clean
+	if cursor != self.drawnCursor {
+		for _, c := range []drawnCursor{self.drawnCursor, cursor} {
+			if c.shown && c.pos.Row < grid.Size.Rows && c.pos.Col < grid.Size.Cols {
+				write(c.pos.Col, c.pos.Row, &grid.viewLine(c.pos.Row)[c.pos.Col])
+				changed = true
+			}
 		}
+		self.drawnCursor = cursor
 	}
 
+	return vertices, changed
+}
+
+// drawnCursor is where the renderer draws the cursor, if it does.
+type drawnCursor struct {
+	pos   GPos
+	shown bool
+}
+
+// visibleCursor is the cursor to draw, hidden by DECTCEM and while the view
+// is scrolled back.
+func (self *Screen) visibleCursor() drawnCursor {
+	grid := self.grid
+	shown := self.modes.Get(ModeCursorVisible) && grid.viewOffset == grid.getDefaultViewOffset()
+	return drawnCursor{pos: *grid.Cursor.Pos, shown: shown}
+}
+
+// writeQuad lays out the quad of a cell, the cell under the cursor is drawn
+// in the cursor colour.
+func writeQuad(quad []float32, atlas *gfx.Atlas, x, y int, size *Size, cell *Cell, palette *Palette, cursor bool) {
+	cw, ch := float32(size.Width), float32(size.Height)
+	l, r := float32(x)*cw, float32(x+1)*cw
+	t, b := float32(y)*ch, float32(y+1)*ch
+	switch cell.Width {
+	case CellWide:
+		// the glyph is drawn over both cells
+		r += cw
+	case CellSpacer:
+		// covered by the quad on its left, this one has no area
+		r = l
+	}
+
+	glyph := gfx.GlyphKey{Text: cell.Text(), Wide: cell.Width == CellWide}
+	if cell.Rune == 0 {
+		glyph.Text = " "
+	}
+	atlas.Update(glyph)
+	if !atlas.Has(glyph) {
+		glyph.Text = " "
+		atlas.Update(glyph)
+	}
+	u0, v0, u1, v1 := atlas.GetUVs(glyph)
+
+	fg, bg := cellColors(cell, palette)
+	if cursor {
+		fg, bg = bg, toRGB(palette.Default(DefaultCursor))
+	}
+	flags := cellFlags(cell)
+
+	corners := [4][6]float32{
+		// x, y, u, v, cell x, cell y
+		{l, b, u0, v1, 0, 1},
+		{r, b, u1, v1, 1, 1},
+		{l, t, u0, v0, 0, 0},
+		{r, t, u1, v0, 1, 0},
+	}
+	for i, c := range corners {
+		copy(quad[i*vertexSize:], []float32{
+			c[0], c[1], 0, c[2], c[3],
+			fg[0], fg[1], fg[2],
+			bg[0], bg[1], bg[2],
+			c[4], c[5], flags,
+		})
+	}
+}
+
+// cellColors resolves the colours a cell is drawn with, after inverse, faint
+// and invisible are applied.
+func cellColors(cell *Cell, palette *Palette) (fg, bg [3]float32) {
+	fg = toRGB(palette.Resolve(cell.Fg))
+	bg = toRGB(palette.Resolve(cell.Bg))
+
+	if cell.Attrs.Has(AttrInverse) {
+		fg, bg = bg, fg
+	}
+	if cell.Attrs.Has(AttrFaint) {
+		for i := range fg {
+			fg[i] = bg[i] + (fg[i]-bg[i])*faintDimming
+		}
+	}
+	if cell.Attrs.Has(AttrInvisible) {
+		fg = bg
+	}
 	return
 }
+
+var attrFlags = []struct {
+	attr Attr
+	flag int
+}{
+	{AttrBold, flagBold},
+	{AttrItalic, flagItalic},
+	{AttrBlink, flagBlink},
+	{AttrStrike, flagStrike},
+	{AttrOverline, flagOverline},
+}
+
+func cellFlags(cell *Cell) float32 {
+	flags := int(cell.Underline) << flagUnderlineShift
+	for _, f := range attrFlags {
+		if cell.Attrs.Has(f.attr) {
+			flags |= f.flag
+		}
+	}
+	return float32(flags)
+}
+
+func toRGB(c color.RGBA) [3]float32 {
+	return [3]float32{float32(c.R) / 0xff, float32(c.G) / 0xff, float32(c.B) / 0xff}
+}
+
+func quadIndices(quads int) []uint32 {
+	indices := make([]uint32, 0, quads*6)
+	for q := range quads {
+		tc := uint32(q * 4)
+		indices = append(indices, []uint32{
+			tc, tc + 1, tc + 2,
+			tc + 1, tc + 2, tc + 3,
+		}...)
+	}
+	return indices
+}
+
+func boolToInt(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package screen
+
+import (
+	"fmt"
+
+	"github.com/moozd/goofed/internal/encoder"
+)
+
+// Name and Version identify goofed to the programs that ask, XTVERSION
+// answers with both and DA2 with versionCode.
+const (
+	Name    = "goofed"
+	Version = "0.1.0"
+	// versionCode is Version as DA2 reports it, major*10000+minor*100+patch
+	versionCode = 100
+)
+
+// deviceAttributes is the DA1 answer: a VT220 with ANSI colour.
+var deviceAttributes = []int{62, 22}
+
+// reportDeviceAttributes answers DA1, DA2 and DA3, the latter with a zero unit id.
+func (self *Screen) reportDeviceAttributes(level int) {
+	switch level {
+	case 1:
+		self.reply(encoder.PrimaryDA(deviceAttributes...))
+	case 2:
+		// 1 is a VT220, the rom cartridge is always 0
+		self.reply(encoder.SecondaryDA(1, versionCode, 0))
+	case 3:
+		self.reply(encoder.TertiaryDA("00000000"))
+	}
+}
+
+// reportStatus answers DSR, 5: the terminal is ready, 6: where the cursor is.
+// DECDSR asks the same with private set, only the cursor position is answered.
+func (self *Screen) reportStatus(kind int, private bool) {
+	grid := self.grid
+	row, col := grid.CursorRow()+1, grid.Cursor.Pos.Col+1
+
+	switch {
+	case kind == 5 && !private:
+		self.reply(encoder.StatusOK())
+	case kind == 6 && !private:
+		self.reply(encoder.CursorPositionReport(row, col))
+	case kind == 6:
+		self.reply(encoder.PrivateCursorPositionReport(row, col))
+	}
+}
+
+func (self *Screen) reportVersion() {
+	self.reply(encoder.Version(fmt.Sprintf("%s(%s)", Name, Version)))
+}
+
+// reportMode answers DECRQM for an ANSI or a DEC private mode.
+func (self *Screen) reportMode(mode int, private bool) {
+	self.reply(encoder.ModeReport(mode, private, self.modes.State(mode, private)))
+}
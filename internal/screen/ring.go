@@ -0,0 +1,114 @@
+package screen
+
+import "unsafe"
+
+// DefaultScrollbackLines is how many lines of history a grid keeps unless
+// configured otherwise.
+const DefaultScrollbackLines = 10000
+
+// ScrollbackLimit caps the history by lines, by the memory its cells take,
+// or both, in which case the tighter one applies. The zero value keeps
+// DefaultScrollbackLines. A zero field next to a set one places no limit of
+// its kind, and a negative Lines turns the scrollback off.
+type ScrollbackLimit struct {
+	Lines int
+	Bytes int
+}
+
+var cellBytes = int(unsafe.Sizeof(Cell{}))
+
+// lines returns how many lines of cols cells the limit allows.
+func (l ScrollbackLimit) lines(cols int) int {
+	n := l.Lines
+	switch {
+	case n < 0:
+		return 0
+	case n == 0 && l.Bytes <= 0:
+		return DefaultScrollbackLines
+	}
+	if l.Bytes > 0 && cols > 0 {
+		byBytes := l.Bytes / (cols * cellBytes)
+		if n <= 0 || byBytes < n {
+			n = byBytes
+		}
+	}
+	return max(n, 0)
+}
+
+// line is a row of cells. wrapped marks a line whose text ran past the
+// right margin and continues on the next one, as opposed to one ended by a
+// newline, so resizing can re-wrap it.
+type line struct {
+	cells   []Cell
+	wrapped bool
+}
+
+// ring holds the lines of a grid, the scrollback followed by the screen. It
+// grows up to max lines, then every new line at the bottom recycles the
+// oldest one, so appending never allocates once the history is full.
+type ring struct {
+	lines []*line
+	// start is where the oldest line is stored
+	start int
+	count int
+	max   int
+}
+
+func newRing(max int) *ring {
+	return &ring{max: max}
+}
+
+func (r *ring) len() int {
+	return r.count
+}
+
+// at returns the i-th line, 0 is the oldest.
+func (r *ring) at(i int) *line {
+	return r.lines[(r.start+i)%len(r.lines)]
+}
+
+// push appends a line of cols cells at the bottom and returns it. evicted
+// tells whether the oldest line had to make room for it, its cells are
+// reused and hold stale content.
+func (r *ring) push(cols int) (l *line, evicted bool) {
+	if r.count < r.max {
+		// lines are only recycled once full, until then start stays at 0
+		l = &line{cells: make([]Cell, cols)}
+		r.lines = append(r.lines, l)
+		r.count++
+		return l, false
+	}
+	if r.count == 0 {
+		return nil, false
+	}
+
+	l = r.lines[r.start]
+	r.start = (r.start + 1) % len(r.lines)
+	if len(l.cells) != cols {
+		l.cells = make([]Cell, cols)
+	}
+	l.wrapped = false
+	return l, true
+}
+
+// setMax changes the capacity, dropping the oldest lines that no longer fit.
+func (r *ring) setMax(max int) {
+	r.max = max
+	r.dropOldest(r.count - max)
+}
+
+// dropOldest removes the n oldest lines and lays the rest out from start 0.
+func (r *ring) dropOldest(n int) {
+	n = clamp(n, 0, r.count)
+	kept := make([]*line, 0, r.count-n)
+	for i := n; i < r.count; i++ {
+		kept = append(kept, r.at(i))
+	}
+	r.lines, r.start, r.count = kept, 0, len(kept)
+}
+
+// replace swaps every line for lines, keeping the newest ones that fit.
+func (r *ring) replace(lines []*line) {
+	r.lines, r.start, r.count = lines, 0, len(lines)
+	r.dropOldest(r.count - r.max)
+}
@@ -2,42 +2,140 @@ package screen
 
 import (
 	"context"
+	"io"
+	"sync"
+	"time"
 
+	"github.com/moozd/goofed/internal/encoder"
 	"github.com/moozd/goofed/internal/parser"
 	"github.com/moozd/goofed/internal/session"
 )
 
 type Screen struct {
 	ctx     context.Context
+	mu      sync.Mutex
 	grid    *Grid
 	parser  *parser.Parser
 	session *session.Session
+	// grid is the active buffer, one of these
+	primary, alternate *Grid
+	// replies is where answers and input go, the session outside of tests
+	replies io.Writer
+	// writeMu keeps writes to replies whole, they come from the read and the
+	// render loop
+	writeMu sync.Mutex
+	// pending are the replies queued while feeding, written after it
+	pending []byte
+
+	pen     Cell
+	saved   *savedCursor
+	palette *Palette
+	// the DECSC state of the inactive buffer, saved belongs to the active one
+	inactiveSaved *savedCursor
+	// charsets are the designated character sets and the shifts between them
+	charsets charsets
+	// last is the last character printed, for REP
+	last rune
+	// modes is the one mode table, the grids and the renderer read it
+	modes *Modes
+	// syncStart is when the program last began a synchronized update
+	syncStart time.Time
+	// modifyOtherKeys is the xterm modifyOtherKeys level set with XTMODKEYS
+	modifyOtherKeys int
+	// keyboard and mouse are only touched by the render loop, which handles input
+	keyboard keyboard
+	mouse    mouse
+	// drawnCursor is only touched by the render loop as well
+	drawnCursor drawnCursor
+	// the kitty keyboard flags stack of the active buffer and of the other one
+	keyboardStack, inactiveKeyboardStack []encoder.KittyFlags
 }
 
-func New(c context.Context, s *session.Session) *Screen {
+// savedCursor is the state stored by DECSC and restored by DECRC.
+type savedCursor struct {
+	pos         GPos
+	pen         Cell
+	wrapPending bool
+	origin      bool
+	charsets    charsets
+}
 
+func New(c context.Context, s *session.Session) *Screen {
+	modes := NewModes()
 	self := &Screen{
-		ctx:     c,
-		session: s,
-		grid:    newGrid(),
-		parser:  parser.New(c, s),
+		ctx:       c,
+		session:   s,
+		replies:   s,
+		modes:     modes,
+		primary:   newGrid(modes),
+		alternate: newAlternateGrid(modes),
+		pen:       defaultPen(),
+		palette:   DefaultPalette(),
+		charsets:  defaultCharsets(),
 	}
-	go self.drainParserQueue()
+	self.grid = self.primary
+	self.parser = parser.NewSync(c, parser.WithPerformer(self))
+	go self.readLoop()
 
 	return self
 }
 
+func defaultPen() Cell {
+	return Cell{Rune: ' ', Fg: defaultFg, Bg: defaultBg}
+}
+
+// SetPalette replaces the colours cells are drawn with.
+func (self *Screen) SetPalette(p *Palette) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.palette = p
+	self.grid.markAllDirty()
+}
+
+// SetScrollbackLimit caps the history of the primary buffer, the alternate
+// one has none.
+func (self *Screen) SetScrollbackLimit(limit ScrollbackLimit) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.primary.SetScrollbackLimit(limit)
+}
+
 func (self *Screen) Close() {
 	self.parser.Close()
 }
 
-func (self *Screen) drainParserQueue() {
-	select {
-	case <-self.ctx.Done():
-		return
-	default:
-		for event := range self.parser.Queue {
-			self.handle(event)
+// readLoop feeds the shell output to the parser a buffer at a time.
+func (self *Screen) readLoop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := self.session.Read(buf)
+		if n > 0 {
+			self.feed(buf[:n])
+		}
+		if err != nil || self.ctx.Err() != nil {
+			return
 		}
 	}
 }
+
+func (self *Screen) feed(b []byte) {
+	self.mu.Lock()
+	self.parser.Feed(b)
+	replies := self.pending
+	self.pending = nil
+	self.mu.Unlock()
+
+	self.send(replies)
+}
+
+// Resize fits the grid to the window and tells the shell about the new size.
+func (self *Screen) Resize(windowWidth, windowHeight int32, blockWidth, blockHeight int32) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.primary.Resize(windowWidth, windowHeight, blockWidth, blockHeight)
+	self.alternate.Resize(windowWidth, windowHeight, blockWidth, blockHeight)
+	self.session.Resize(self.grid.Size.Rows, self.grid.Size.Cols)
+}
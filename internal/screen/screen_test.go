@@ -0,0 +1,1147 @@
+package screen
+
+import (
+	"bytes"
+	"context"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/moozd/goofed/internal/encoder"
+	"github.com/moozd/goofed/internal/parser"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func newTestScreen(rows, cols int) *Screen {
+	modes := NewModes()
+	self := &Screen{
+		ctx:       context.Background(),
+		modes:     modes,
+		primary:   newTestGrid(newGrid(modes), rows, cols),
+		alternate: newTestGrid(newAlternateGrid(modes), rows, cols),
+		pen:       defaultPen(),
+		palette:   DefaultPalette(),
+		charsets:  defaultCharsets(),
+		replies:   &bytes.Buffer{},
+	}
+	self.grid = self.primary
+	self.parser = parser.NewSync(self.ctx, parser.WithPerformer(self))
+	return self
+}
+
+func newTestGrid(grid *Grid, rows, cols int) *Grid {
+	grid.resize(rows, cols)
+	return grid
+}
+
+// replied returns what the screen answered since the last call.
+func (self *Screen) replied() string {
+	buf := self.replies.(*bytes.Buffer)
+	defer buf.Reset()
+	return buf.String()
+}
+
+// lines renders the active screen, trailing blanks trimmed.
+func (self *Screen) lines() []string {
+	out := make([]string, self.grid.Size.Rows)
+	for row := range out {
+		var b strings.Builder
+		for _, c := range self.grid.lineAt(row) {
+			b.WriteString(cellText(c))
+		}
+		out[row] = strings.TrimRight(b.String(), " ")
+	}
+	return out
+}
+
+// cellText is what a cell adds to a rendered line, the right half of a wide
+// character adds nothing and the padding before a wrapped one a space.
+func cellText(c Cell) string {
+	switch {
+	case c.Width == CellSpacer:
+		return ""
+	case c.Rune == 0:
+		return " "
+	}
+	return c.Text()
+}
+
+func expectLines(t *testing.T, s *Screen, want ...string) {
+	t.Helper()
+	got := s.lines()
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("screen:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func expectCursor(t *testing.T, s *Screen, row, col int) {
+	t.Helper()
+	if pos := s.grid.Cursor.Pos; pos.Row != row || pos.Col != col {
+		t.Errorf("cursor at %d,%d, want %d,%d", pos.Row, pos.Col, row, col)
+	}
+}
+
+func TestScreen_Print(t *testing.T) {
+	s := newTestScreen(3, 5)
+	s.feed([]byte("ab\r\ncdefgh\r\nij"))
+
+	expectLines(t, s, "cdefg", "h", "ij")
+	expectCursor(t, s, 2, 2)
+}
+
+func TestScreen_CursorMovement(t *testing.T) {
+	s := newTestScreen(4, 10)
+
+	s.feed([]byte("\x1b[3;4H"))
+	expectCursor(t, s, 2, 3)
+	s.feed([]byte("\x1b[A\x1b[2C"))
+	expectCursor(t, s, 1, 5)
+	s.feed([]byte("\x1b[9B\x1b[99D"))
+	expectCursor(t, s, 3, 0)
+	s.feed([]byte("\x1b[7G\x1b[2d"))
+	expectCursor(t, s, 1, 6)
+	// x lands in the last column, the cursor stays on it
+	s.feed([]byte("\x1b[H\t\tx\x08\x08"))
+	expectCursor(t, s, 0, 7)
+}
+
+func TestScreen_CursorLineMovement(t *testing.T) {
+	tests := []struct {
+		name     string
+		seq      string
+		row, col int
+	}{
+		{"CNL", "\x1b[2;5H\x1b[E", 2, 0},
+		{"CNL clamps", "\x1b[2;5H\x1b[9E", 3, 0},
+		{"CPL", "\x1b[3;5H\x1b[2F", 0, 0},
+		{"HPA", "\x1b[2;5H\x1b[3`", 1, 2},
+		{"HPR", "\x1b[2;5H\x1b[2a", 1, 6},
+		{"HPR clamps", "\x1b[2;5H\x1b[99a", 1, 9},
+		{"VPR", "\x1b[1;5H\x1b[2e", 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScreen(4, 10)
+			s.feed([]byte(tt.seq))
+			expectCursor(t, s, tt.row, tt.col)
+		})
+	}
+}
+
+func TestScreen_Erase(t *testing.T) {
+	s := newTestScreen(3, 5)
+	s.feed([]byte("abcde\r\nfghij\r\nklmno"))
+
+	s.feed([]byte("\x1b[2;3H\x1b[K"))
+	expectLines(t, s, "abcde", "fg", "klmno")
+	s.feed([]byte("\x1b[1;2H\x1b[2X"))
+	expectLines(t, s, "a  de", "fg", "klmno")
+	s.feed([]byte("\x1b[3;3H\x1b[1K"))
+	expectLines(t, s, "a  de", "fg", "   no")
+	s.feed([]byte("\x1b[2;1H\x1b[J"))
+	expectLines(t, s, "a  de", "", "")
+	s.feed([]byte("x\x1b[2J"))
+	expectLines(t, s, "", "", "")
+}
+
+func TestScreen_SaveRestoreCursor(t *testing.T) {
+	s := newTestScreen(3, 5)
+	s.feed([]byte("\x1b[2;3H\x1b7\x1b[H\x1b8x"))
+
+	expectLines(t, s, "", "  x", "")
+}
+
+func TestScreen_SGR(t *testing.T) {
+	tests := []struct {
+		seq       string
+		attrs     Attr
+		underline UnderlineStyle
+		fg, bg    color.Color
+	}{
+		{"\x1b[1;3;4m", AttrBold | AttrItalic, UnderlineSingle, defaultFg, defaultBg},
+		{"\x1b[2;5;7;8;9;53m", AttrFaint | AttrBlink | AttrInverse | AttrInvisible | AttrStrike | AttrOverline, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[4:3m", 0, UnderlineCurly, defaultFg, defaultBg},
+		{"\x1b[4:5m\x1b[4:0m", 0, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[21m", 0, UnderlineDouble, defaultFg, defaultBg},
+		{"\x1b[1;2;3;4;5;7;8;9;53m\x1b[22;23;24;25;27;28;29;55m", 0, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[31;42m", 0, UnderlineNone, IndexedColor(1), IndexedColor(2)},
+		{"\x1b[97;104m", 0, UnderlineNone, IndexedColor(15), IndexedColor(12)},
+		{"\x1b[31;42m\x1b[39;49m", 0, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[1;31m\x1b[m", 0, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[1;31m\x1b[0;3m", AttrItalic, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[38;5;1;48;2;3;4;9;1m", AttrBold, UnderlineNone, IndexedColor(1), color.RGBA{3, 4, 9, 0xff}},
+		{"\x1b[38:2::3:4:5;48:5:200m", 0, UnderlineNone, color.RGBA{3, 4, 5, 0xff}, IndexedColor(200)},
+		{"\x1b[38:2:3:4:5m", 0, UnderlineNone, color.RGBA{3, 4, 5, 0xff}, defaultBg},
+		{"\x1b[58;2;1;2;3;9m", AttrStrike, UnderlineNone, defaultFg, defaultBg},
+		{"\x1b[38;5;300;1m", AttrBold, UnderlineNone, defaultFg, defaultBg},
+	}
+
+	for _, tt := range tests {
+		s := newTestScreen(1, 5)
+		s.feed([]byte(tt.seq + "x"))
+
+		c := s.grid.lineAt(0)[0]
+		if c.Attrs != tt.attrs || c.Underline != tt.underline || c.Fg != tt.fg || c.Bg != tt.bg {
+			t.Errorf("%q: got attrs %b underline %d fg %v bg %v, want %b %d %v %v",
+				tt.seq, c.Attrs, c.Underline, c.Fg, c.Bg, tt.attrs, tt.underline, tt.fg, tt.bg)
+		}
+	}
+}
+
+func TestScreen_OscColors(t *testing.T) {
+	s := newTestScreen(1, 5)
+	p := s.palette
+
+	s.feed([]byte("\x1b]4;1;rgb:12/34/56;300;#fff;2;#a0b0c0\x07"))
+	if got := p.Color(1); got != (color.RGBA{0x12, 0x34, 0x56, 0xff}) {
+		t.Errorf("OSC 4 set colour 1 to %v", got)
+	}
+	if got := p.Color(2); got != (color.RGBA{0xa0, 0xb0, 0xc0, 0xff}) {
+		t.Errorf("OSC 4 set colour 2 to %v", got)
+	}
+
+	s.feed([]byte("\x1b]4;1;?\x1b\\"))
+	if got, want := s.replied(), "\x1b]4;1;rgb:1212/3434/5656\x1b\\"; got != want {
+		t.Errorf("OSC 4 query replied %q, want %q", got, want)
+	}
+
+	s.feed([]byte("\x1b]104;1\x07"))
+	if got := p.Color(1); got != xtermColors[1] {
+		t.Errorf("OSC 104 reset colour 1 to %v", got)
+	}
+	if got := p.Color(2); got == xtermColors[2] {
+		t.Errorf("OSC 104;1 reset colour 2 too")
+	}
+	s.feed([]byte("\x1b]104\x07"))
+	if got := p.Color(2); got != xtermColors[2] {
+		t.Errorf("OSC 104 reset colour 2 to %v", got)
+	}
+
+	s.feed([]byte("\x1b]10;#000000;rgb:ff/ff/ff\x07"))
+	if fg, bg := p.Default(DefaultForeground), p.Default(DefaultBackground); fg != (color.RGBA{0, 0, 0, 0xff}) || bg != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("OSC 10 set fg %v bg %v", fg, bg)
+	}
+	s.feed([]byte("\x1b]11;?\x07\x1b]10;?\x07"))
+	if got, want := s.replied(), "\x1b]11;rgb:ffff/ffff/ffff\x07\x1b]10;rgb:0000/0000/0000\x07"; got != want {
+		t.Errorf("OSC 10/11 query replied %q, want %q", got, want)
+	}
+	s.feed([]byte("\x1b]4;2;?\x07"))
+	if got, want := s.replied(), "\x1b]4;2;rgb:0000/cdcd/0000\x07"; got != want {
+		t.Errorf("BEL terminated OSC 4 query replied %q, want %q", got, want)
+	}
+
+	s.feed([]byte("\x1b]110\x07\x1b]111\x07"))
+	if p.Default(DefaultForeground) != xtermDefaults[DefaultForeground] || p.Default(DefaultBackground) != xtermDefaults[DefaultBackground] {
+		t.Errorf("OSC 110/111 did not reset the defaults")
+	}
+}
+
+func TestPalette(t *testing.T) {
+	p := DefaultPalette()
+
+	tests := []struct {
+		c    color.Color
+		want color.RGBA
+	}{
+		{IndexedColor(1), color.RGBA{0xcd, 0, 0, 0xff}},
+		{IndexedColor(16), color.RGBA{0, 0, 0, 0xff}},
+		{IndexedColor(196), color.RGBA{0xff, 0, 0, 0xff}},
+		{IndexedColor(231), color.RGBA{0xff, 0xff, 0xff, 0xff}},
+		{IndexedColor(232), color.RGBA{8, 8, 8, 0xff}},
+		{IndexedColor(255), color.RGBA{0xee, 0xee, 0xee, 0xff}},
+		{DefaultBackground, color.RGBA{0, 0, 0, 0xff}},
+		{color.White, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		if got := p.Resolve(tt.c); got != tt.want {
+			t.Errorf("Resolve(%v) = %v, want %v", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestParseColorSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want color.RGBA
+		ok   bool
+	}{
+		{"rgb:ff/80/00", color.RGBA{0xff, 0x80, 0x00, 0xff}, true},
+		{"rgb:ffff/0000/8080", color.RGBA{0xff, 0x00, 0x80, 0xff}, true},
+		{"rgb:f/0/8", color.RGBA{0xff, 0x00, 0x88, 0xff}, true},
+		{"#102030", color.RGBA{0x10, 0x20, 0x30, 0xff}, true},
+		{"#fff", color.RGBA{0xff, 0xff, 0xff, 0xff}, true},
+		{"rgb:ff/80", color.RGBA{}, false},
+		{"rgb:fffff/0/0", color.RGBA{}, false},
+		{"#12345", color.RGBA{}, false},
+		{"red", color.RGBA{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseColorSpec(tt.spec)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseColorSpec(%q) = %v, %v, want %v, %v", tt.spec, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// scrollback returns the lines above the active screen, trailing blanks trimmed.
+func (self *Screen) scrollback() []string {
+	var out []string
+	for row := range self.grid.historyLen() {
+		var b strings.Builder
+		for _, c := range self.grid.lines.at(row).cells {
+			b.WriteRune(c.Rune)
+		}
+		out = append(out, strings.TrimRight(b.String(), " "))
+	}
+	return out
+}
+
+func TestScreen_ScrollRegion(t *testing.T) {
+	s := newTestScreen(5, 3)
+	s.feed([]byte("a\r\nb\r\nc\r\nd\r\ne"))
+
+	// a region from row 2 to 4, lines scrolled inside it are lost
+	s.feed([]byte("\x1b[2;4r"))
+	expectCursor(t, s, 0, 0)
+	s.feed([]byte("\x1b[4;1H\nx"))
+	expectLines(t, s, "a", "c", "d", "x", "e")
+	if got := s.scrollback(); len(got) != 0 {
+		t.Errorf("partial region scrolled into the scrollback: %q", got)
+	}
+
+	// reverse index at the top margin
+	s.feed([]byte("\x1b[2;1H\x1bMy"))
+	expectLines(t, s, "a", "y", "c", "d", "e")
+
+	s.feed([]byte("\x1b[2S"))
+	expectLines(t, s, "a", "d", "", "", "e")
+	s.feed([]byte("\x1b[T"))
+	expectLines(t, s, "a", "", "d", "", "e")
+
+	// the cursor below the region moves down but never scrolls
+	s.feed([]byte("\x1b[5;1H\n\n"))
+	expectCursor(t, s, 4, 0)
+	expectLines(t, s, "a", "", "d", "", "e")
+}
+
+// Lines scrolled in at a margin take the current background, as in xterm.
+func TestScreen_ScrollKeepsBackground(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  string
+		row  int
+	}{
+		{"LF at the bottom margin", "\x1b[2;3r\x1b[44m\x1b[3;1H\n", 2},
+		{"autowrap at the bottom margin", "\x1b[44m\x1b[3;1Habcx", 2},
+		{"RI at the top margin", "\x1b[2;3r\x1b[44m\x1b[2;1H\x1bM", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScreen(3, 3)
+			s.feed([]byte(tt.seq))
+			for col, c := range s.grid.lineAt(tt.row) {
+				if c.Rune == 'x' {
+					continue
+				}
+				if c.Bg != IndexedColor(4) {
+					t.Errorf("cell %d,%d has background %v, want %v", tt.row, col, c.Bg, IndexedColor(4))
+				}
+			}
+		})
+	}
+}
+
+func TestScreen_ScrollFullRegion(t *testing.T) {
+	s := newTestScreen(3, 3)
+	s.feed([]byte("a\r\nb\r\nc\x1b[r\x1b[3;1H\n\x1b[Sd"))
+
+	expectLines(t, s, "c", "", "d")
+	if got := s.scrollback(); strings.Join(got, "|") != "a|b" {
+		t.Errorf("scrollback %q, want a, b", got)
+	}
+}
+
+func TestScreen_InsertDeleteLines(t *testing.T) {
+	s := newTestScreen(5, 3)
+	s.feed([]byte("a\r\nb\r\nc\r\nd\r\ne\x1b[1;4r"))
+
+	s.feed([]byte("\x1b[2;2H\x1b[2L"))
+	expectCursor(t, s, 1, 0)
+	expectLines(t, s, "a", "", "", "b", "e")
+
+	s.feed([]byte("\x1b[M"))
+	expectLines(t, s, "a", "", "b", "", "e")
+
+	s.feed([]byte("\x1b[9M"))
+	expectLines(t, s, "a", "", "", "", "e")
+
+	// outside the region IL and DL do nothing
+	s.feed([]byte("\x1b[5;1H\x1b[L"))
+	expectLines(t, s, "a", "", "", "", "e")
+}
+
+func TestScreen_AlternateScreen(t *testing.T) {
+	for _, mode := range []string{"47", "1047", "1049"} {
+		s := newTestScreen(3, 4)
+		s.feed([]byte("ab\r\ncd\x1b[1;2H"))
+
+		s.feed([]byte("\x1b[?" + mode + "h"))
+		if s.grid != s.alternate {
+			t.Fatalf("mode %s: alternate screen not active", mode)
+		}
+		expectCursor(t, s, 0, 1)
+		expectLines(t, s, "", "", "")
+
+		s.feed([]byte("\x1b[3;1Hx\n\n\n"))
+		if got := s.alternate.lines.len(); got != 3 {
+			t.Errorf("mode %s: alternate screen grew to %d lines", mode, got)
+		}
+
+		s.feed([]byte("\x1b[?" + mode + "l"))
+		if s.grid != s.primary {
+			t.Fatalf("mode %s: primary screen not restored", mode)
+		}
+		expectLines(t, s, "ab", "cd", "")
+		if mode == "1049" {
+			expectCursor(t, s, 0, 1)
+		} else {
+			expectCursor(t, s, 2, 1)
+		}
+	}
+}
+
+func TestScreen_AlternateScreenKeepsContent(t *testing.T) {
+	// 47 keeps the alternate content across switches, 1047 clears it on leave
+	s := newTestScreen(2, 4)
+	s.feed([]byte("\x1b[?47hx\x1b[?47l\x1b[?47h"))
+	expectLines(t, s, "x", "")
+
+	s = newTestScreen(2, 4)
+	s.feed([]byte("\x1b[?1047hx\x1b[?1047l\x1b[?1047h"))
+	expectLines(t, s, "", "")
+}
+
+func TestScreen_AlternateScreenSavedCursor(t *testing.T) {
+	s := newTestScreen(3, 4)
+	s.feed([]byte("\x1b[2;2H\x1b7\x1b[?47h\x1b[3;3H\x1b7\x1b[?47l\x1b8"))
+	expectCursor(t, s, 1, 1)
+	s.feed([]byte("\x1b[?47h\x1b8"))
+	expectCursor(t, s, 2, 2)
+}
+
+func TestScreen_ScrollbackLimit(t *testing.T) {
+	s := newTestScreen(2, 3)
+	s.grid.SetScrollbackLimit(ScrollbackLimit{Lines: 3})
+	s.feed([]byte("1\r\n2\r\n3\r\n4\r\n5\r\n6"))
+
+	expectLines(t, s, "5", "6")
+	if got := s.scrollback(); strings.Join(got, "|") != "2|3|4" {
+		t.Errorf("scrollback %q, want 2, 3, 4", got)
+	}
+
+	// a view scrolled into the history stays on the same lines while the
+	// oldest ones are evicted
+	s.grid.Scroll(-2)
+	s.feed([]byte("\r\n7"))
+	if top := s.grid.lines.at(s.grid.viewOffset).cells[0].Rune; top != '3' {
+		t.Errorf("view starts at %q, want '3'", top)
+	}
+
+	s.grid.SetScrollbackLimit(ScrollbackLimit{Lines: 1})
+	if got := s.scrollback(); strings.Join(got, "|") != "5" {
+		t.Errorf("scrollback %q after lowering the limit, want 5", got)
+	}
+
+	s.feed([]byte("\x1b[3J"))
+	if got := s.scrollback(); len(got) != 0 {
+		t.Errorf("scrollback %q after ED 3", got)
+	}
+}
+
+func TestScrollbackLimit_Bytes(t *testing.T) {
+	limit := ScrollbackLimit{Lines: 100, Bytes: 10 * 80 * cellBytes}
+	if got := limit.lines(80); got != 10 {
+		t.Errorf("byte limit allows %d lines, want 10", got)
+	}
+	if got := (ScrollbackLimit{Bytes: 10 * 80 * cellBytes}).lines(80); got != 10 {
+		t.Errorf("byte limit alone allows %d lines, want 10", got)
+	}
+	if got := (ScrollbackLimit{}).lines(80); got != DefaultScrollbackLines {
+		t.Errorf("zero limit allows %d lines, want %d", got, DefaultScrollbackLines)
+	}
+	if got := (ScrollbackLimit{Lines: -1, Bytes: 1 << 20}).lines(80); got != 0 {
+		t.Errorf("negative limit allows %d lines, want 0", got)
+	}
+}
+
+func TestRing_PushRecyclesOnceFull(t *testing.T) {
+	r := newRing(4)
+	for range 4 {
+		r.push(80)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, evicted := r.push(80); !evicted {
+			t.Fatal("full ring did not evict")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("push allocated %v times once full", allocs)
+	}
+	if r.len() != 4 {
+		t.Errorf("ring holds %d lines, want 4", r.len())
+	}
+}
+
+func TestScreen_ReflowNarrower(t *testing.T) {
+	s := newTestScreen(3, 6)
+	s.feed([]byte("abcdef\r\n12\r\nxyz"))
+
+	s.grid.resize(4, 3)
+	expectLines(t, s, "abc", "def", "12", "xyz")
+	// the cursor past the end of xyz stays on its line
+	expectCursor(t, s, 3, 2)
+	if !s.grid.rowAt(0).wrapped || s.grid.rowAt(1).wrapped {
+		t.Errorf("re-wrapped lines lost their soft wrap flags")
+	}
+
+	s.grid.resize(3, 3)
+	expectLines(t, s, "def", "12", "xyz")
+	if got := s.scrollback(); strings.Join(got, "|") != "abc" {
+		t.Errorf("scrollback %q, want abc", got)
+	}
+}
+
+func TestScreen_ReflowWider(t *testing.T) {
+	s := newTestScreen(3, 3)
+	s.feed([]byte("abcdefg\r\n12"))
+	expectLines(t, s, "def", "g", "12")
+
+	s.grid.resize(3, 8)
+	expectLines(t, s, "abcdefg", "12", "")
+	expectCursor(t, s, 1, 2)
+	if got := s.scrollback(); len(got) != 0 {
+		t.Errorf("scrollback %q, want it pulled back onto the screen", got)
+	}
+
+	// and back, the paragraph wraps the same way it was printed
+	s.grid.resize(3, 3)
+	expectLines(t, s, "def", "g", "12")
+	if got := s.scrollback(); strings.Join(got, "|") != "abc" {
+		t.Errorf("scrollback %q, want abc", got)
+	}
+}
+
+func TestScreen_ReflowKeepsHardNewlines(t *testing.T) {
+	s := newTestScreen(3, 4)
+	s.feed([]byte("ab\r\ncd\x1b[3;3H"))
+
+	s.grid.resize(3, 2)
+	expectLines(t, s, "ab", "cd", "")
+	expectCursor(t, s, 2, 1)
+}
+
+func TestScreen_ResizeTaller(t *testing.T) {
+	s := newTestScreen(2, 3)
+	s.feed([]byte("a\r\nb\r\nc"))
+
+	s.grid.resize(4, 3)
+	expectLines(t, s, "a", "b", "c", "")
+	expectCursor(t, s, 2, 1)
+
+	s.grid.resize(2, 3)
+	expectLines(t, s, "b", "c")
+	expectCursor(t, s, 1, 1)
+}
+
+func TestScreen_ResizeFillsBlanks(t *testing.T) {
+	s := newTestScreen(2, 2)
+	s.grid.resize(3, 4)
+
+	for row := range 3 {
+		for col, c := range s.grid.lineAt(row) {
+			if c.Rune != 0 && c.Rune != ' ' || c.Fg != defaultFg || c.Bg != defaultBg {
+				t.Errorf("cell %d,%d is %+v, want a blank", row, col, c)
+			}
+		}
+	}
+}
+
+func TestScreen_ResizeKeepsCursorLine(t *testing.T) {
+	s := newTestScreen(5, 10)
+	s.feed([]byte("a\r\nb\r\nc\r\nd\r\ne\x1b[1;1H"))
+
+	s.grid.resize(3, 10)
+	expectCursor(t, s, 0, 0)
+	expectLines(t, s, "a", "b", "c")
+	if got := s.scrollback(); len(got) != 0 {
+		t.Errorf("lines above the cursor were pushed to the scrollback: %q", got)
+	}
+
+	s.feed([]byte("X"))
+	expectLines(t, s, "X", "b", "c")
+
+	// with the cursor lower, the lines above it make the room
+	s.feed([]byte("\x1b[3;1H"))
+	s.grid.resize(2, 10)
+	expectCursor(t, s, 1, 0)
+	expectLines(t, s, "b", "c")
+}
+
+func TestScreen_ResizeAlternateClips(t *testing.T) {
+	s := newTestScreen(2, 4)
+	s.feed([]byte("\x1b[?1049habcd"))
+
+	s.alternate.resize(2, 2)
+	expectLines(t, s, "ab", "")
+}
+
+func TestScreen_WideChars(t *testing.T) {
+	s := newTestScreen(3, 5)
+	s.feed([]byte("ab漢字"))
+
+	// 字 does not fit in the last column and wraps whole
+	expectLines(t, s, "ab漢", "字", "")
+	expectCursor(t, s, 1, 2)
+	line := s.grid.lineAt(0)
+	if line[2].Width != CellWide || line[3].Width != CellSpacer || line[4].Rune != 0 {
+		t.Errorf("row 0 widths %v %v %v, pad %q", line[2].Width, line[3].Width, line[4].Width, line[4].Rune)
+	}
+	if !s.grid.rowAt(0).wrapped {
+		t.Errorf("row 0 should be wrapped")
+	}
+
+	// writing over either half erases the whole character
+	s.feed([]byte("[1;4Hx[2;1Hy"))
+	expectLines(t, s, "ab x", "y", "")
+	if c := s.grid.lineAt(1)[1]; c.Width != CellNarrow || c.Rune != ' ' {
+		t.Errorf("spacer left behind: %+v", c)
+	}
+}
+
+func TestScreen_GraphemeClusters(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+		wide bool
+		col  int
+	}{
+		{"combining mark", "e\u0301", "e\u0301", false, 1},
+		{"zwj sequence", "👩\u200d💻", "👩\u200d💻", true, 2},
+		{"flag", "🇯🇵", "🇯🇵", true, 2},
+		{"emoji presentation", "❤\ufe0f", "❤\ufe0f", true, 2},
+		{"text presentation", "❤\ufe0e", "❤\ufe0e", false, 1},
+		{"two flags", "🇯🇵🇫🇷", "🇯🇵", true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScreen(2, 6)
+			s.feed([]byte(tt.text))
+
+			c := s.grid.lineAt(0)[0]
+			if c.Text() != tt.want || (c.Width == CellWide) != tt.wide {
+				t.Errorf("cell %q wide %v, want %q wide %v", c.Text(), c.Width == CellWide, tt.want, tt.wide)
+			}
+			expectCursor(t, s, 0, tt.col)
+		})
+	}
+
+	// a mark with nothing before it is dropped
+	s := newTestScreen(2, 6)
+	s.feed([]byte("\u0301a"))
+	expectLines(t, s, "a", "")
+}
+
+func TestScreen_ReflowWideChars(t *testing.T) {
+	s := newTestScreen(3, 5)
+	s.feed([]byte("ab漢字"))
+
+	s.grid.resize(3, 3)
+	expectLines(t, s, "ab", "漢", "字")
+
+	s.grid.resize(3, 6)
+	expectLines(t, s, "ab漢字", "", "")
+	expectCursor(t, s, 0, 5)
+}
+
+func TestScreen_TabStops(t *testing.T) {
+	s := newTestScreen(2, 20)
+
+	s.feed([]byte("a\tb"))
+	expectCursor(t, s, 0, 9)
+	s.feed([]byte("\t\t"))
+	expectCursor(t, s, 0, 19)
+
+	// a stop at 3, CBT goes back through it
+	s.feed([]byte("\x1b[1;4H\x1bH\x1b[2Z"))
+	expectCursor(t, s, 0, 0)
+	s.feed([]byte("\x1b[2I"))
+	expectCursor(t, s, 0, 8)
+
+	// TBC 0 clears the stop under the cursor, 3 all of them
+	s.feed([]byte("\x1b[g\r\t"))
+	expectCursor(t, s, 0, 3)
+	s.feed([]byte("\x1b[3g\r\t"))
+	expectCursor(t, s, 0, 19)
+
+	// a wider grid gets the default stops in its new columns
+	s.feed([]byte("\x1bc"))
+	s.grid.resize(2, 12)
+	s.feed([]byte("\x1b[1;4H\x1bH"))
+	s.grid.resize(2, 30)
+	s.feed([]byte("\r\t\t\t\t"))
+	expectCursor(t, s, 0, 24)
+	s.feed([]byte("\x1b[3Z"))
+	expectCursor(t, s, 0, 3)
+}
+
+func TestScreen_PendingWrap(t *testing.T) {
+	s := newTestScreen(3, 5)
+
+	s.feed([]byte("abcde"))
+	expectCursor(t, s, 0, 4)
+	if !s.grid.Cursor.wrapPending {
+		t.Fatalf("no wrap pending after the last column")
+	}
+	// a carriage return cancels the wrap, the next line is untouched
+	s.feed([]byte("\rX"))
+	expectLines(t, s, "Xbcde", "", "")
+
+	s.feed([]byte("\x1b[1;5Hef"))
+	expectLines(t, s, "Xbcde", "f", "")
+	expectCursor(t, s, 1, 1)
+
+	// without DECAWM the last column is overwritten
+	s.feed([]byte("\x1b[?7l\x1b[3;4Hxyz"))
+	expectLines(t, s, "Xbcde", "f", "   xz")
+	expectCursor(t, s, 2, 4)
+}
+
+func TestScreen_OriginMode(t *testing.T) {
+	s := newTestScreen(6, 5)
+
+	s.feed([]byte("\x1b[2;4r\x1b[?6h"))
+	expectCursor(t, s, 1, 0)
+	s.feed([]byte("\x1b[2;3H"))
+	expectCursor(t, s, 2, 2)
+	s.feed([]byte("\x1b[6n"))
+	if got := s.replied(); got != "\x1b[2;3R" {
+		t.Errorf("CPR %q", got)
+	}
+	// addressing cannot leave the region
+	s.feed([]byte("\x1b[9;1H"))
+	expectCursor(t, s, 3, 0)
+
+	s.feed([]byte("\x1b[?6l"))
+	expectCursor(t, s, 0, 0)
+	// CUU and CUD stop at the margins from inside the region
+	s.feed([]byte("\x1b[3H\x1b[9A"))
+	expectCursor(t, s, 1, 0)
+	s.feed([]byte("\x1b[9B"))
+	expectCursor(t, s, 3, 0)
+	s.feed([]byte("\x1b[6H\x1b[9A"))
+	expectCursor(t, s, 1, 0)
+}
+
+func TestScreen_InsertDeleteChars(t *testing.T) {
+	s := newTestScreen(2, 6)
+	s.feed([]byte("abcdef"))
+
+	s.feed([]byte("\x1b[1;2H\x1b[2@"))
+	expectLines(t, s, "a  bcd", "")
+	s.feed([]byte("\x1b[3P"))
+	expectLines(t, s, "acd", "")
+
+	// IRM shifts the line as text is printed
+	s.feed([]byte("\x1b[4hXY\x1b[4lZ"))
+	expectLines(t, s, "aXYZd", "")
+	expectCursor(t, s, 0, 4)
+
+	// deleting half of a wide character erases the other half
+	s.feed([]byte("\r\x1b[K漢字\x1b[1;2H\x1b[P"))
+	expectLines(t, s, " 字", "")
+}
+
+func TestScreen_Repeat(t *testing.T) {
+	s := newTestScreen(2, 8)
+	s.feed([]byte("ab\x1b[3b-\x1b[b"))
+
+	expectLines(t, s, "abbbb--", "")
+}
+
+func TestScreen_Charsets(t *testing.T) {
+	s := newTestScreen(4, 8)
+
+	// G0 as line drawing
+	s.feed([]byte("\x1b(0lqqk\x1b(Bq\r\n"))
+	// G1 through SO and SI
+	s.feed([]byte("\x1b)0x\x0ex\x0fx\r\n"))
+	// a single shift covers one character
+	s.feed([]byte("\x1b*A\x1bN##\r\n"))
+	// DECSC keeps the sets
+	s.feed([]byte("\x1b(0\x1b7\x1b(B\x1b8q"))
+	expectLines(t, s, "┌──┐q", "x│x", "£#", "─")
+
+	// RIS resets them
+	s.feed([]byte("\x1bcq"))
+	expectLines(t, s, "q", "", "", "")
+}
+
+func TestScreen_Reports(t *testing.T) {
+	s := newTestScreen(4, 10)
+	s.feed([]byte("\x1b[2;3H"))
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"\x1b[c", "\x1b[?62;22c"},
+		{"\x1b[0c", "\x1b[?62;22c"},
+		{"\x1b[>c", "\x1b[>1;100;0c"},
+		{"\x1b[=c", "\x1bP!|00000000\x1b\\"},
+		{"\x1b[5n", "\x1b[0n"},
+		{"\x1b[6n", "\x1b[2;3R"},
+		{"\x1b[?6n", "\x1b[?2;3R"},
+		{"\x1b[>q", "\x1bP>|goofed(0.1.0)\x1b\\"},
+		{"\x1b[4$p", "\x1b[4;2$y"},
+		{"\x1b[?7$p", "\x1b[?7;1$y"},
+		{"\x1b[?6$p", "\x1b[?6;2$y"},
+		{"\x1b[?1049$p", "\x1b[?1049;2$y"},
+		{"\x1b[?1048h\x1b[?1048$p", "\x1b[?1048;1$y"},
+		{"\x1b[?1048l\x1b[?1048$p", "\x1b[?1048;2$y"},
+		{"\x1b[?9999$p", "\x1b[?9999;0$y"},
+		{"\x1b[4h\x1b[?1049h\x1b[4$p\x1b[?1049$p", "\x1b[4;1$y\x1b[?1049;1$y"},
+	}
+	for _, tt := range tests {
+		s.feed([]byte(tt.query))
+		if got := s.replied(); got != tt.want {
+			t.Errorf("%q answered %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// blockedWriter stands for a program that stopped reading its input.
+type blockedWriter struct {
+	writing, release chan struct{}
+}
+
+func (w *blockedWriter) Write(p []byte) (int, error) {
+	w.writing <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+// Replies are written after the lock is released, a blocked write must not
+// stop the renderer.
+func TestScreen_RepliesOutsideLock(t *testing.T) {
+	s := newTestScreen(2, 5)
+	w := &blockedWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	s.replies = w
+
+	done := make(chan struct{})
+	go func() {
+		s.feed([]byte("\x1b[c\x1b[6n"))
+		close(done)
+	}()
+
+	<-w.writing
+	if !s.mu.TryLock() {
+		t.Error("the screen stays locked while a reply is written")
+	} else {
+		s.mu.Unlock()
+	}
+	close(w.release)
+	<-done
+}
+
+func TestLookupMode(t *testing.T) {
+	tests := []struct {
+		number  int
+		private bool
+		mode    Mode
+		ok      bool
+	}{
+		{4, false, ModeInsert, true},
+		{20, false, ModeLineFeed, true},
+		{1, true, ModeCursorKeys, true},
+		{7, true, ModeAutowrap, true},
+		{25, true, ModeCursorVisible, true},
+		{1049, true, ModeAltScreenSaveCursor, true},
+		{2004, true, ModeBracketedPaste, true},
+		{2026, true, ModeSyncOutput, true},
+		{7, false, 0, false},
+		{4, true, 0, false},
+		{9999, true, 0, false},
+	}
+	for _, tt := range tests {
+		mode, ok := LookupMode(tt.number, tt.private)
+		if ok != tt.ok || (ok && mode != tt.mode) {
+			t.Errorf("LookupMode(%d, %v) = %v %v, want %v %v", tt.number, tt.private, mode, ok, tt.mode, tt.ok)
+		}
+		if ok && (mode.Number() != tt.number || mode.Private() != tt.private) {
+			t.Errorf("%v is %d private %v", mode, mode.Number(), mode.Private())
+		}
+	}
+}
+
+func TestScreen_Modes(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  string
+		mode Mode
+		want bool
+	}{
+		{"initial autowrap", "", ModeAutowrap, true},
+		{"initial cursor visible", "", ModeCursorVisible, true},
+		{"DECSET", "\x1b[?1h", ModeCursorKeys, true},
+		{"DECRST", "\x1b[?1h\x1b[?1l", ModeCursorKeys, false},
+		{"DECSET list", "\x1b[?1;2004h", ModeBracketedPaste, true},
+		{"SM", "\x1b[4h", ModeInsert, true},
+		{"SM is not DECSET", "\x1b[?4h", ModeInsert, false},
+		{"DECKPAM", "\x1b=", ModeApplicationKeypad, true},
+		{"DECKPNM", "\x1b=\x1b>", ModeApplicationKeypad, false},
+		{"mouse tracking is exclusive", "\x1b[?1000h\x1b[?1003h", ModeMouseNormal, false},
+		{"mouse tracking last set", "\x1b[?1000h\x1b[?1003h", ModeMouseAny, true},
+		{"mouse encoding is exclusive", "\x1b[?1006h\x1b[?1015h", ModeMouseSGR, false},
+		{"alternate screen any way in", "\x1b[?1049h", ModeAltScreen, true},
+		{"XTRESTORE", "\x1b[?2004h\x1b[?2004s\x1b[?2004l\x1b[?2004r", ModeBracketedPaste, true},
+		{"XTRESTORE unsaved", "\x1b[?7l\x1b[?7r", ModeAutowrap, true},
+		{"RIS", "\x1b[?1h\x1b[?7l\x1bc", ModeCursorKeys, false},
+		{"RIS initial", "\x1b[?1h\x1b[?7l\x1bc", ModeAutowrap, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScreen(3, 5)
+			s.feed([]byte(tt.seq))
+			if got := s.modes.Get(tt.mode); got != tt.want {
+				t.Errorf("%v is %v, want %v", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreen_ModeSideEffects(t *testing.T) {
+	s := newTestScreen(3, 5)
+
+	// XTRESTORE switches back through the same path as DECRST
+	s.feed([]byte("\x1b[?1049s\x1b[?1049hx\x1b[?1049r"))
+	if s.grid != s.primary {
+		t.Errorf("XTRESTORE did not leave the alternate screen")
+	}
+
+	// LNM turns LF into a newline
+	s.feed([]byte("\x1bc\x1b[20hab\ncd"))
+	expectLines(t, s, "ab", "cd", "")
+}
+
+func TestScreen_Keyboard(t *testing.T) {
+	s := newTestScreen(2, 10)
+	key := func(sym sdl.Keycode, mod uint16) {
+		s.keyDown(&sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Sym: sym, Mod: mod}})
+	}
+
+	tests := []struct {
+		name  string
+		setup string
+		input func()
+		want  string
+	}{
+		{"text", "", func() { s.textInput("hé") }, "hé"},
+		{"enter", "", func() { key(sdl.K_RETURN, 0); s.textInput("\r") }, "\r"},
+		{"ctrl letter drops its text", "", func() { key('c', sdl.KMOD_LCTRL); s.textInput("c") }, "\x03"},
+		{"alt prefixes the text", "", func() { key('x', sdl.KMOD_LALT); s.textInput("x") }, "\x1bx"},
+		{"altgr types as is", "", func() { key('q', sdl.KMOD_RALT); s.textInput("@") }, "@"},
+		{"cursor keys", "", func() { key(sdl.K_UP, 0) }, "\x1b[A"},
+		{"DECCKM", "\x1b[?1h", func() { key(sdl.K_UP, 0) }, "\x1bOA"},
+		{"keypad numeric", "", func() { key(sdl.K_KP_1, 0); s.textInput("1") }, "1"},
+		{"DECKPAM", "\x1b=", func() { key(sdl.K_KP_1, 0); s.textInput("1") }, "\x1bOq"},
+		{"modifyOtherKeys", "\x1b[>4;2m", func() { key('a', sdl.KMOD_LCTRL) }, "\x1b[27;5;97~"},
+		{"modifyOtherKeys reset", "\x1b[>4;2m\x1b[>4m", func() { key('a', sdl.KMOD_LCTRL) }, "\x01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.feed([]byte("\x1bc" + tt.setup))
+			s.replied()
+			tt.input()
+			if got := s.replied(); got != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreen_KittyKeyboardFlags(t *testing.T) {
+	s := newTestScreen(2, 10)
+	query := func() string {
+		s.feed([]byte("\x1b[?u"))
+		return s.replied()
+	}
+
+	steps := []struct {
+		input string
+		want  string
+	}{
+		{"", "\x1b[?0u"},
+		{"\x1b[>1u", "\x1b[?1u"},
+		{"\x1b[>13u", "\x1b[?13u"},
+		{"\x1b[=2;3u", "\x1b[?13u"},
+		{"\x1b[=2;2u", "\x1b[?15u"},
+		{"\x1b[=4;3u", "\x1b[?11u"},
+		{"\x1b[=255u", "\x1b[?31u"},
+		{"\x1b[<u", "\x1b[?1u"},
+		{"\x1b[<5u", "\x1b[?0u"},
+		{"\x1b[=3;1u", "\x1b[?3u"},
+	}
+	for _, step := range steps {
+		s.feed([]byte(step.input))
+		if got := query(); got != step.want {
+			t.Errorf("after %q: got %q, want %q", step.input, got, step.want)
+		}
+	}
+
+	// each buffer has its own stack
+	s.feed([]byte("\x1b[?1049h"))
+	if got := query(); got != "\x1b[?0u" {
+		t.Errorf("alternate screen: got %q, want %q", got, "\x1b[?0u")
+	}
+	s.feed([]byte("\x1b[>8u\x1b[?1049l"))
+	if got := query(); got != "\x1b[?3u" {
+		t.Errorf("primary screen: got %q, want %q", got, "\x1b[?3u")
+	}
+
+	for range keyboardStackSize + 4 {
+		s.feed([]byte("\x1b[>1u"))
+	}
+	if len(s.keyboardStack) != keyboardStackSize {
+		t.Errorf("stack grew to %d entries", len(s.keyboardStack))
+	}
+
+	s.feed([]byte("\x1bc"))
+	if got := query(); got != "\x1b[?0u" {
+		t.Errorf("after RIS: got %q, want %q", got, "\x1b[?0u")
+	}
+}
+
+func TestScreen_KittyKeyboard(t *testing.T) {
+	s := newTestScreen(2, 10)
+	key := func(typ uint32, repeat uint8, sym sdl.Keycode, mod uint16) {
+		s.keyEvent(&sdl.KeyboardEvent{Type: typ, Repeat: repeat, Keysym: sdl.Keysym{Sym: sym, Mod: mod}})
+	}
+	press := func(sym sdl.Keycode, mod uint16) { key(sdl.KEYDOWN, 0, sym, mod) }
+	release := func(sym sdl.Keycode, mod uint16) { key(sdl.KEYUP, 0, sym, mod) }
+
+	tests := []struct {
+		name  string
+		setup string
+		input func()
+		want  string
+	}{
+		{"legacy without flags", "", func() { press(sdl.K_ESCAPE, 0); release(sdl.K_ESCAPE, 0) }, "\x1b"},
+		{"disambiguate escape", "\x1b[>1u", func() { press(sdl.K_ESCAPE, 0) }, "\x1b[27u"},
+		{"disambiguate ctrl", "\x1b[>1u", func() { press('c', sdl.KMOD_LCTRL); s.textInput("c") }, "\x1b[99;5u"},
+		{"plain text stays text", "\x1b[>1u", func() { press('a', 0); s.textInput("a") }, "a"},
+		{"enter stays legacy", "\x1b[>1u", func() { press(sdl.K_RETURN, 0); s.textInput("\r") }, "\r"},
+		{"keypad digit stays text", "\x1b[>1u", func() { press(sdl.K_KP_1, sdl.KMOD_NUM); s.textInput("1") }, "1"},
+		{"keypad enter", "\x1b[>1u", func() { press(sdl.K_KP_ENTER, 0); s.textInput("\r") }, "\x1b[57414u"},
+		{"release not asked for", "\x1b[>1u", func() { release('c', sdl.KMOD_LCTRL) }, ""},
+		{"repeat and release", "\x1b[>3u", func() {
+			key(sdl.KEYDOWN, 1, sdl.K_UP, 0)
+			release(sdl.K_UP, 0)
+		}, "\x1b[1;1:2A\x1b[1;1:3A"},
+		{"alternate keys", "\x1b[>13u", func() { press('a', sdl.KMOD_LSHIFT); s.textInput("A") }, "\x1b[97:65;2u"},
+		{"modifier keys", "\x1b[>8u", func() { press(sdl.K_LSHIFT, sdl.KMOD_LSHIFT) }, "\x1b[57441;2u"},
+		{"associated text", "\x1b[>25u", func() { press('a', sdl.KMOD_LSHIFT); s.textInput("A") }, "\x1b[97;2;65u"},
+		{"keys without text are sent at once", "\x1b[>25u", func() {
+			press(sdl.K_ESCAPE, 0)
+			press(sdl.K_UP, 0)
+			press('a', sdl.KMOD_LCTRL)
+		}, "\x1b[27u\x1b[A\x1b[97;5u"},
+		{"text key waits for its text", "\x1b[>25u", func() { press('a', 0) }, ""},
+		{"text key flushed after the events", "\x1b[>25u", func() { press('a', 0); s.flushKey() }, "\x1b[97u"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.keyboard = keyboard{}
+			s.feed([]byte("\x1bc" + tt.setup))
+			s.replied()
+			tt.input()
+			if got := s.replied(); got != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreen_Mouse(t *testing.T) {
+	s := newTestScreen(3, 5)
+	button := func(typ uint32, b uint8, x, y int32) {
+		s.mouseButton(&sdl.MouseButtonEvent{Type: typ, Button: b, X: x, Y: y})
+	}
+	press := func(x, y int32) { button(sdl.MOUSEBUTTONDOWN, sdl.BUTTON_LEFT, x, y) }
+	release := func(x, y int32) { button(sdl.MOUSEBUTTONUP, sdl.BUTTON_LEFT, x, y) }
+	move := func(x, y int32) { s.mouseMotion(&sdl.MouseMotionEvent{X: x, Y: y}) }
+
+	tests := []struct {
+		name  string
+		setup string
+		input func()
+		want  string
+	}{
+		{"not tracking", "", func() { press(0, 0); release(0, 0) }, ""},
+		{"X10 presses only", "\x1b[?9h", func() { press(12, 25); release(12, 25) }, "\x1b[M \"#"},
+		{"normal", "\x1b[?1000h", func() { press(0, 0); move(20, 0); release(20, 0) }, "\x1b[M !!\x1b[M##!"},
+		{"button motion", "\x1b[?1002h\x1b[?1006h", func() {
+			move(0, 0)
+			press(0, 0)
+			move(5, 5)
+			move(15, 5)
+			release(15, 5)
+			move(25, 5)
+		}, "\x1b[<0;1;1M\x1b[<32;2;1M\x1b[<0;2;1m"},
+		{"any motion", "\x1b[?1003h\x1b[?1006h", func() { move(25, 5) }, "\x1b[<35;3;1M"},
+		{"right button", "\x1b[?1000h\x1b[?1006h", func() { button(sdl.MOUSEBUTTONDOWN, sdl.BUTTON_RIGHT, 0, 10) }, "\x1b[<2;1;2M"},
+		{"clamped to the grid", "\x1b[?1000h\x1b[?1006h", func() { press(500, -3) }, "\x1b[<0;5;1M"},
+		{"urxvt", "\x1b[?1000h\x1b[?1015h", func() { press(40, 20) }, "\x1b[32;5;3M"},
+		{"utf8", "\x1b[?1000h\x1b[?1005h", func() { press(40, 20) }, "\x1b[M %#"},
+		{"sgr pixels", "\x1b[?1000h\x1b[?1016h", func() { press(17, 4); release(17, 4) }, "\x1b[<0;18;5M\x1b[<0;18;5m"},
+		{"wheel", "\x1b[?1000h\x1b[?1006h", func() {
+			move(15, 15)
+			s.mouseWheel(&sdl.MouseWheelEvent{Y: 2})
+			s.mouseWheel(&sdl.MouseWheelEvent{Y: 1, Direction: sdl.MOUSEWHEEL_FLIPPED})
+		}, "\x1b[<64;2;2M\x1b[<64;2;2M\x1b[<65;2;2M"},
+		{"shift bypasses reporting", "\x1b[?1000h\x1b[?1006h", func() {
+			s.mouseEvent(encoder.MouseEvent{Button: encoder.MouseLeft, Mods: encoder.ModShift}, 0, 0)
+		}, ""},
+		{"modifiers", "\x1b[?1000h\x1b[?1006h", func() {
+			s.mouseEvent(encoder.MouseEvent{Button: encoder.MouseLeft, Mods: encoder.ModCtrl}, 0, 0)
+		}, "\x1b[<16;1;1M"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.feed([]byte("\x1bc" + tt.setup))
+			s.replied()
+			tt.input()
+			if got := s.replied(); got != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreen_VisibleCursor(t *testing.T) {
+	s := newTestScreen(2, 5)
+	s.feed([]byte("ab"))
+	if got, want := s.visibleCursor(), (drawnCursor{pos: GPos{Row: 0, Col: 2}, shown: true}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	s.feed([]byte("\x1b[?25l"))
+	if s.visibleCursor().shown {
+		t.Error("DECTCEM reset left the cursor shown")
+	}
+	s.feed([]byte("\x1b[?25h\r\n\r\n\r\n"))
+	s.grid.Scroll(-1)
+	if s.visibleCursor().shown {
+		t.Error("the cursor is shown while the view is scrolled back")
+	}
+}
@@ -0,0 +1,121 @@
+package screen
+
+// SetMargins implements DECSTBM, top and bottom are the 0 based rows of the
+// scroll region. Invalid regions are ignored like xterm does, and false is
+// returned.
+func (self *Grid) SetMargins(top, bottom int) bool {
+	bottom = min(bottom, self.Size.Rows-1)
+	if top < 0 || top >= bottom {
+		return false
+	}
+	self.top, self.bottom = top, bottom
+	return true
+}
+
+func (self *Grid) resetMargins() {
+	self.top, self.bottom = 0, max(self.Size.Rows-1, 0)
+}
+
+// fullRegion tells whether the scroll region spans the whole screen, only
+// then do lines scrolled off the top go to the scrollback.
+func (self *Grid) fullRegion() bool {
+	return self.top == 0 && self.bottom == self.Size.Rows-1
+}
+
+func (self *Grid) inRegion(row int) bool {
+	return row >= self.top && row <= self.bottom
+}
+
+// ScrollUp implements SU, the scroll region moves up n lines and blank
+// lines come in at its bottom.
+func (self *Grid) ScrollUp(n int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+	n = min(n, self.bottom-self.top+1)
+
+	if self.fullRegion() && !self.noScrollback {
+		for range n {
+			self.pushScrollback(blank)
+		}
+		return
+	}
+	self.shiftUp(self.top, n, blank)
+}
+
+// ScrollDown implements SD, the scroll region moves down n lines and blank
+// lines come in at its top. Lines leaving the bottom are lost.
+func (self *Grid) ScrollDown(n int, blank Cell) {
+	if self.isEmpty() {
+		return
+	}
+	self.shiftDown(self.top, n, blank)
+}
+
+// InsertLines implements IL, blank lines are inserted at the cursor row and
+// the lines below it are pushed down to the bottom margin.
+func (self *Grid) InsertLines(n int, blank Cell) {
+	if self.isEmpty() || !self.inRegion(self.Cursor.Pos.Row) {
+		return
+	}
+	self.shiftDown(self.Cursor.Pos.Row, n, blank)
+	self.CarriageReturn()
+}
+
+// DeleteLines implements DL, the lines from the cursor row are removed and
+// the ones below move up, blank lines come in at the bottom margin.
+func (self *Grid) DeleteLines(n int, blank Cell) {
+	if self.isEmpty() || !self.inRegion(self.Cursor.Pos.Row) {
+		return
+	}
+	self.shiftUp(self.Cursor.Pos.Row, n, blank)
+	self.CarriageReturn()
+}
+
+// shiftUp moves the lines from top to the bottom margin up by n.
+func (self *Grid) shiftUp(top, n int, blank Cell) {
+	n = min(n, self.bottom-top+1)
+	for row := top; row <= self.bottom-n; row++ {
+		self.copyLine(row, row+n)
+	}
+	for row := self.bottom - n + 1; row <= self.bottom; row++ {
+		self.clearLine(row, blank)
+	}
+}
+
+// shiftDown moves the lines from top to the bottom margin down by n.
+func (self *Grid) shiftDown(top, n int, blank Cell) {
+	n = min(n, self.bottom-top+1)
+	for row := self.bottom; row >= top+n; row-- {
+		self.copyLine(row, row-n)
+	}
+	for row := top; row < top+n; row++ {
+		self.clearLine(row, blank)
+	}
+}
+
+func (self *Grid) copyLine(dst, src int) {
+	to, from := self.rowAt(dst), self.rowAt(src)
+	for i := range to.cells {
+		self.setCell(&to.cells[i], from.cells[i])
+	}
+	to.wrapped = from.wrapped
+}
+
+// pushScrollback moves the top line of the screen into the scrollback. Once
+// the scrollback is full its oldest line is recycled for the new bottom one.
+func (self *Grid) pushScrollback(blank Cell) {
+	follow := self.viewOffset == self.getDefaultViewOffset()
+
+	line, evicted := self.lines.push(self.Size.Cols)
+	self.fill(line.cells, blank)
+
+	switch {
+	case follow:
+		self.ResetViewOffset()
+	case evicted:
+		// the lines in view moved up with the eviction
+		self.viewOffset = max(self.viewOffset-1, 0)
+	}
+	self.markAllDirty()
+}
@@ -0,0 +1,170 @@
+package screen
+
+import (
+	"image/color"
+
+	"github.com/moozd/goofed/internal/parser"
+)
+
+// Attr is the set of SGR rendition flags of a cell.
+type Attr uint16
+
+const (
+	AttrBold Attr = 1 << iota
+	AttrFaint
+	AttrItalic
+	AttrBlink
+	AttrInverse
+	AttrInvisible
+	AttrStrike
+	AttrOverline
+)
+
+func (a Attr) Has(flag Attr) bool {
+	return a&flag != 0
+}
+
+type UnderlineStyle uint8
+
+const (
+	UnderlineNone UnderlineStyle = iota
+	UnderlineSingle
+	UnderlineDouble
+	UnderlineCurly
+	UnderlineDotted
+	UnderlineDashed
+)
+
+// sgr applies Select Graphic Rendition to the pen. Every parameter of the
+// list is applied in order, an empty list is a reset.
+func (self *Screen) sgr(params *parser.Params) {
+	if params.Len() == 0 {
+		self.resetRendition()
+		return
+	}
+
+	for i := 0; i < params.Len(); i++ {
+		p := params.Param(i)
+		pen := &self.pen
+
+		switch n := p.Value(0); {
+		case n == 0:
+			self.resetRendition()
+		case n == 1:
+			pen.Attrs |= AttrBold
+		case n == 2:
+			pen.Attrs |= AttrFaint
+		case n == 3:
+			pen.Attrs |= AttrItalic
+		case n == 4:
+			pen.Underline = UnderlineSingle
+			if p.HasSubs() && p.Sub(0, 1) <= int(UnderlineDashed) {
+				pen.Underline = UnderlineStyle(p.Sub(0, 1))
+			}
+		case n == 5, n == 6:
+			pen.Attrs |= AttrBlink
+		case n == 7:
+			pen.Attrs |= AttrInverse
+		case n == 8:
+			pen.Attrs |= AttrInvisible
+		case n == 9:
+			pen.Attrs |= AttrStrike
+		case n == 21:
+			pen.Underline = UnderlineDouble
+		case n == 22:
+			pen.Attrs &^= AttrBold | AttrFaint
+		case n == 23:
+			pen.Attrs &^= AttrItalic
+		case n == 24:
+			pen.Underline = UnderlineNone
+		case n == 25:
+			pen.Attrs &^= AttrBlink
+		case n == 27:
+			pen.Attrs &^= AttrInverse
+		case n == 28:
+			pen.Attrs &^= AttrInvisible
+		case n == 29:
+			pen.Attrs &^= AttrStrike
+		case n >= 30 && n <= 37:
+			pen.Fg = IndexedColor(n - 30)
+		case n == 38:
+			c, used := extendedColor(params, i)
+			if c != nil {
+				pen.Fg = c
+			}
+			i += used
+		case n == 39:
+			pen.Fg = defaultFg
+		case n >= 40 && n <= 47:
+			pen.Bg = IndexedColor(n - 40)
+		case n == 48:
+			c, used := extendedColor(params, i)
+			if c != nil {
+				pen.Bg = c
+			}
+			i += used
+		case n == 49:
+			pen.Bg = defaultBg
+		case n == 58:
+			// underline colours are not drawn, only their arguments are skipped
+			_, used := extendedColor(params, i)
+			i += used
+		case n == 53:
+			pen.Attrs |= AttrOverline
+		case n == 55:
+			pen.Attrs &^= AttrOverline
+		case n >= 90 && n <= 97:
+			pen.Fg = IndexedColor(n - 90 + 8)
+		case n >= 100 && n <= 107:
+			pen.Bg = IndexedColor(n - 100 + 8)
+		}
+	}
+}
+
+// extendedColor reads the colour of SGR 38/48/58 at i, 5;N for a palette
+// entry or 2;R;G;B for a direct colour. It returns how many of the ';'
+// separated parameters that follow it used, the ':' form, as in 38:2::R:G:B,
+// carries its arguments as sub-parameters and uses none. A malformed colour
+// is nil.
+func extendedColor(params *parser.Params, i int) (color.Color, int) {
+	p := params.Param(i)
+	if p.HasSubs() {
+		switch p.Sub(0, -1) {
+		case 5:
+			return indexed(p.Sub(1, -1)), 0
+		case 2:
+			// the colour space id is optional, 38:2:R:G:B is common too
+			if p.SubLen() >= 5 {
+				return rgb(p.Sub(2, 0), p.Sub(3, 0), p.Sub(4, 0)), 0
+			}
+			return rgb(p.Sub(1, 0), p.Sub(2, 0), p.Sub(3, 0)), 0
+		}
+		return nil, 0
+	}
+
+	switch params.Get(i+1, -1) {
+	case 5:
+		return indexed(params.Get(i+2, -1)), 2
+	case 2:
+		return rgb(params.Get(i+2, 0), params.Get(i+3, 0), params.Get(i+4, 0)), 4
+	}
+	return nil, 0
+}
+
+func indexed(n int) color.Color {
+	if n < 0 || n > 255 {
+		return nil
+	}
+	return IndexedColor(n)
+}
+
+func rgb(r, g, b int) color.Color {
+	return color.RGBA{uint8(min(r, 255)), uint8(min(g, 255)), uint8(min(b, 255)), 0xff}
+}
+
+func (self *Screen) resetRendition() {
+	self.pen.Fg = defaultFg
+	self.pen.Bg = defaultBg
+	self.pen.Attrs = 0
+	self.pen.Underline = UnderlineNone
+}
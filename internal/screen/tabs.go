@@ -0,0 +1,79 @@
+package screen
+
+// tabWidth is the distance between the default tab stops.
+const tabWidth = 8
+
+// resizeTabs fits the tab stops to cols columns, the stops set so far are
+// kept and the new columns get the default ones.
+func (self *Grid) resizeTabs(cols int) {
+	old := len(self.tabs)
+	if cols <= old {
+		self.tabs = self.tabs[:cols]
+		return
+	}
+	self.tabs = append(self.tabs, make([]bool, cols-old)...)
+	for col := old; col < cols; col++ {
+		self.tabs[col] = col > 0 && col%tabWidth == 0
+	}
+}
+
+// resetTabs puts back a stop every tabWidth columns.
+func (self *Grid) resetTabs() {
+	self.tabs = self.tabs[:0]
+	self.resizeTabs(self.Size.Cols)
+}
+
+// SetTabStop implements HTS, a stop at the cursor column.
+func (self *Grid) SetTabStop() {
+	if col := self.Cursor.Pos.Col; col < len(self.tabs) {
+		self.tabs[col] = true
+	}
+}
+
+// ClearTabStop implements TBC, 0: the stop at the cursor column, 3: every stop.
+func (self *Grid) ClearTabStop(mode int) {
+	switch mode {
+	case 0:
+		if col := self.Cursor.Pos.Col; col < len(self.tabs) {
+			self.tabs[col] = false
+		}
+	case 3:
+		clear(self.tabs)
+	}
+}
+
+// TabForward implements HT and CHT, the cursor moves to the n-th next stop
+// or the last column.
+func (self *Grid) TabForward(n int) {
+	if self.isEmpty() {
+		return
+	}
+
+	col := self.Cursor.Pos.Col
+	for ; n > 0 && col < self.Size.Cols-1; n-- {
+		col++
+		for col < self.Size.Cols-1 && !self.tabs[col] {
+			col++
+		}
+	}
+	self.Cursor.Pos.Col = col
+	self.Cursor.wrapPending = false
+}
+
+// TabBackward implements CBT, the cursor moves to the n-th previous stop or
+// the first column.
+func (self *Grid) TabBackward(n int) {
+	if self.isEmpty() {
+		return
+	}
+
+	col := self.Cursor.Pos.Col
+	for ; n > 0 && col > 0; n-- {
+		col--
+		for col > 0 && !self.tabs[col] {
+			col--
+		}
+	}
+	self.Cursor.Pos.Col = col
+	self.Cursor.wrapPending = false
+}
@@ -15,3 +15,13 @@ func slice[T any](s []T, start, end int) []T {
 	}
 	return s[start:end]
 }
+
+func clamp(n, lo, hi int) int {
+	if n > hi {
+		n = hi
+	}
+	if n < lo {
+		n = lo
+	}
+	return n
+}
@@ -0,0 +1,75 @@
+package screen
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// CellWidth tells how a cell takes part in a character two columns wide.
+type CellWidth uint8
+
+const (
+	// CellNarrow is a character of one column, the zero value.
+	CellNarrow CellWidth = iota
+	// CellWide holds a character that also covers the cell on its right.
+	CellWide
+	// CellSpacer is the right half of a wide character, it draws nothing.
+	CellSpacer
+)
+
+const (
+	zeroWidthJoiner = 0x200d
+	emojiStyle      = 0xfe0f // VS16
+)
+
+// runeWidth returns the columns r takes, the way wcwidth counts them: 0 for
+// combining marks and format characters, 2 for East Asian wide and fullwidth
+// characters, 1 for the rest.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0xad: // the soft hyphen is a format character shown as a hyphen
+		return 1
+	case r >= 0x1160 && r <= 0x11ff: // Hangul medial vowels and final consonants
+		return 0
+	case r == 0x200b:
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// extendsCluster tells whether r belongs to the grapheme cluster in c rather
+// than starting a cell of its own: zero width marks and selectors, the
+// character after a ZWJ, and the second regional indicator of a flag.
+func extendsCluster(c *Cell, r rune) bool {
+	switch last, _ := utf8.DecodeLastRuneInString(c.Text()); {
+	case runeWidth(r) == 0:
+		return true
+	case last == zeroWidthJoiner:
+		return true
+	case isRegionalIndicator(r):
+		return c.Cluster == "" && isRegionalIndicator(c.Rune)
+	}
+	return false
+}
+
+// widensCluster tells whether appending r turns a narrow cluster into a wide
+// one. A flag takes the two columns programs count for its two regional
+// indicators, and VS16 asks for the emoji presentation, which is two columns
+// wide as in kitty and foot. VS15 never narrows a wide cluster, the columns
+// programs counted for it are already taken.
+func widensCluster(r rune) bool {
+	return r == emojiStyle || isRegionalIndicator(r)
+}
@@ -46,6 +46,10 @@ func (s *Session) Read(data []byte) (int, error) {
 	return s.fd.Read(data)
 }
 
+func (s *Session) Resize(rows, cols int) error {
+	return pty.Setsize(s.fd, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+}
+
 func (s *Session) Close() error {
 	s.cancel()
 	if err := s.fd.Close(); err != nil {
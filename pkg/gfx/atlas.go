@@ -15,10 +15,10 @@ type Atlas struct {
 	texId      uint32
 	dirty      bool
 	queue      []*Glyph
-	meta       map[rune]*atlasGMeta
-	row, col   int
+	meta       map[GlyphKey]*atlasGMeta
 	rows, cols int
-	total      int
+	// next is the first free slot, slots are cells counted row by row
+	next int
 }
 
 type atlasGMeta struct {
@@ -32,7 +32,7 @@ func NewAtlas(gm *Font) *Atlas {
 	a.dirty = true
 	a.initAtlasSize(256)
 
-	a.meta = make(map[rune]*atlasGMeta)
+	a.meta = make(map[GlyphKey]*atlasGMeta)
 	a.img = image.NewRGBA(image.Rect(0, 0, a.cols*gm.AdvanceWidth, a.rows*gm.LineHeight))
 	draw.Draw(a.img, a.img.Bounds(), image.Black, image.Point{}, draw.Src)
 
@@ -53,15 +53,22 @@ func (a *Atlas) initAtlasSize(rectWidth int) {
 	a.rows = a.cols
 }
 
-func (a *Atlas) advance() {
-	a.col = (a.total - 1) % a.cols
-	a.row = int(math.Floor(float64((a.total - 1) / a.cols)))
-	log.Printf("row: %d, col: %d", a.row, a.col)
+// allocate reserves the slots of a glyph, a wide glyph takes two next to
+// each other on the same row.
+func (a *Atlas) allocate(cells int) (x, y int) {
+	if a.next%a.cols+cells > a.cols {
+		a.next += a.cols - a.next%a.cols
+	}
+	col, row := a.next%a.cols, a.next/a.cols
+	a.next += cells
+	log.Printf("row: %d, col: %d", row, col)
+	return col * a.gm.AdvanceWidth, row * a.gm.LineHeight
 }
 
-func (a *Atlas) Update(runes ...rune) {
+// Update adds the glyphs of keys, those missing from the font are left out.
+func (a *Atlas) Update(keys ...GlyphKey) {
 
-	for _, c := range runes {
+	for _, c := range keys {
 		if _, ok := a.meta[c]; ok {
 			continue
 		}
@@ -71,14 +78,12 @@ func (a *Atlas) Update(runes ...rune) {
 			continue
 		}
 
-		a.total += 1
-
+		x, y := a.allocate(c.cells())
 		a.meta[c] = &atlasGMeta{
 			added: true,
-			X:     a.col * a.gm.AdvanceWidth,
-			Y:     a.row * a.gm.LineHeight,
+			X:     x,
+			Y:     y,
 		}
-		a.advance()
 
 		log.Printf("X:%d ,Y:%d\n", a.meta[c].X, a.meta[c].Y)
 
@@ -89,13 +94,20 @@ func (a *Atlas) Update(runes ...rune) {
 
 }
 
-func (a *Atlas) GetUVs(r rune) (u0, v0, u1, v1 float32) {
-	m := a.meta[r]
+// Has reports whether k was added, glyphs missing from the font never are.
+func (a *Atlas) Has(k GlyphKey) bool {
+	_, ok := a.meta[k]
+	return ok
+}
+
+// GetUVs returns the texture coordinates of k, two cells wide for a wide glyph.
+func (a *Atlas) GetUVs(k GlyphKey) (u0, v0, u1, v1 float32) {
+	m := a.meta[k]
 	W := float32(a.img.Bounds().Dx())
 	H := float32(a.img.Bounds().Dy())
 
 	u0 = float32(m.X) / W
-	u1 = float32(m.X+a.gm.AdvanceWidth) / W
+	u1 = float32(m.X+k.cells()*a.gm.AdvanceWidth) / W
 	v0 = float32(m.Y) / H
 	v1 = float32(m.Y+a.gm.LineHeight) / H
 	return
@@ -113,7 +125,7 @@ func (a *Atlas) Compile() {
 
 		src := tex.DistanceField
 
-		m := a.meta[tex.char]
+		m := a.meta[tex.key]
 
 		x, y := m.X, m.Y
 
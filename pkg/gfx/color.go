@@ -7,9 +7,9 @@ type OpenGLColor struct {
 }
 
 func toOpenGLColor(c color.RGBA) (r, g, b, a float32) {
-	r = float32(c.R / 255)
-	g = float32(c.G / 255)
-	b = float32(c.B / 255)
-	a = float32(c.A)
+	r = float32(c.R) / 255
+	g = float32(c.G) / 255
+	b = float32(c.B) / 255
+	a = float32(c.A) / 255
 	return
 }
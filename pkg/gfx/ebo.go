@@ -15,12 +15,20 @@ func NewEBO(indices []uint32) *EBO {
 	diagnose()
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ebo.id)
 	diagnose()
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, U32.SizeOf(len(indices)), gl.Ptr(indices), gl.STATIC_DRAW)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, U32.SizeOf(len(indices)), ptr(indices), gl.STATIC_DRAW)
 	diagnose()
 
 	return ebo
 }
 
+// Update replaces the indices, call it with the VAO that owns the EBO bound.
+func (v *EBO) Update(indices []uint32) {
+	v.Bind()
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, U32.SizeOf(len(indices)), ptr(indices), gl.STATIC_DRAW)
+	diagnose()
+	v.indices = indices
+}
+
 func (v *EBO) ID() uint32 {
 	return v.id
 }
@@ -5,6 +5,7 @@ import (
 	"image/draw"
 	"log"
 	"os"
+	"unicode/utf8"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
@@ -14,13 +15,27 @@ import (
 type Font struct {
 	font         *opentype.Font
 	face         font.Face
-	cache        map[rune]*Glyph
+	cache        map[GlyphKey]*Glyph
 	LineHeight   int
 	AdvanceWidth int
 }
 
+// GlyphKey names a glyph: a character or a grapheme cluster, drawn over one
+// cell or, when Wide, over two.
+type GlyphKey struct {
+	Text string
+	Wide bool
+}
+
+func (k GlyphKey) cells() int {
+	if k.Wide {
+		return 2
+	}
+	return 1
+}
+
 type Glyph struct {
-	char          rune
+	key           GlyphKey
 	Source        *image.Gray
 	DistanceField *image.Gray
 }
@@ -28,7 +43,7 @@ type Glyph struct {
 func NewFont(addr string, size int) (*Font, error) {
 
 	gm := &Font{
-		cache: make(map[rune]*Glyph),
+		cache: make(map[GlyphKey]*Glyph),
 	}
 
 	gm.createFace(addr, float32(size))
@@ -41,19 +56,22 @@ func (gm *Font) Close() {
 	gm.face.Close()
 }
 
-func (gm *Font) Get(r rune) (*Glyph, bool) {
-	meta, ok := gm.cache[r]
+// Get returns the glyph of a character or a grapheme cluster, the marks of a
+// cluster are drawn over its base character. ok is false when the font has
+// no glyph for the base character.
+func (gm *Font) Get(k GlyphKey) (*Glyph, bool) {
+	meta, ok := gm.cache[k]
 
 	if ok {
 		return meta, true
 	}
 
-	meta, ok = gm.createGlyph(r)
+	meta, ok = gm.createGlyph(k)
 	if !ok {
 		return nil, false
 	}
 
-	gm.cache[r] = meta
+	gm.cache[k] = meta
 
 	return meta, true
 }
@@ -113,9 +131,13 @@ func (gm *Font) computeBoundingBoxSize() {
 	gm.AdvanceWidth = width
 }
 
-func (gm *Font) createGlyph(r rune) (*Glyph, bool) {
+func (gm *Font) createGlyph(k GlyphKey) (*Glyph, bool) {
+	base, _ := utf8.DecodeRuneInString(k.Text)
+	if _, ok := gm.face.GlyphAdvance(base); !ok {
+		return nil, false
+	}
 
-	width := gm.AdvanceWidth
+	width := gm.AdvanceWidth * k.cells()
 	height := gm.LineHeight
 
 	img := image.NewGray(image.Rect(0, 0, width, height))
@@ -132,10 +154,15 @@ func (gm *Font) createGlyph(r rune) (*Glyph, bool) {
 		Dot:  fixed.Point26_6{X: fixed.I(0), Y: fixed.I(baseline)},
 	}
 
-	d.DrawString(string(r))
+	// joiners and selectors the font has no glyph for are left out
+	for _, r := range k.Text {
+		if _, ok := gm.face.GlyphAdvance(r); ok {
+			d.DrawString(string(r))
+		}
+	}
 
 	meta := &Glyph{
-		char:          r,
+		key:           k,
 		Source:        img,
 		DistanceField: generateSDF(img.Pix, height, width),
 	}
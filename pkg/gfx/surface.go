@@ -10,11 +10,22 @@ import (
 )
 
 type ResizeHandler = func(w, h int32)
+type KeyHandler = func(e *sdl.KeyboardEvent)
+type TextHandler = func(text string)
+type MouseButtonHandler = func(e *sdl.MouseButtonEvent)
+type MouseMotionHandler = func(e *sdl.MouseMotionEvent)
+type MouseWheelHandler = func(e *sdl.MouseWheelEvent)
 
 type Surface struct {
 	win           *sdl.Window
 	gctx          sdl.GLContext
 	resizeHandler ResizeHandler
+	keyHandler    KeyHandler
+	textHandler   TextHandler
+	buttonHandler MouseButtonHandler
+	motionHandler MouseMotionHandler
+	wheelHandler  MouseWheelHandler
+	eventsHandled func()
 	bg            color.RGBA
 	Projection    mgl32.Mat4
 }
@@ -29,6 +40,22 @@ func (s *Surface) Size() (w, h int32) { w, h = s.win.GetSize(); return }
 
 func (s *Surface) OnResize(fn ResizeHandler) { s.resizeHandler = fn }
 
+// OnKey is called for every key press, repeat and release.
+func (s *Surface) OnKey(fn KeyHandler) { s.keyHandler = fn }
+
+// OnTextInput is called with the text a key press typed, after its OnKey.
+func (s *Surface) OnTextInput(fn TextHandler) { s.textHandler = fn }
+
+// OnMouseButton is called for every mouse button press and release.
+func (s *Surface) OnMouseButton(fn MouseButtonHandler) { s.buttonHandler = fn }
+
+func (s *Surface) OnMouseMotion(fn MouseMotionHandler) { s.motionHandler = fn }
+
+func (s *Surface) OnMouseWheel(fn MouseWheelHandler) { s.wheelHandler = fn }
+
+// OnEventsHandled is called once the events queued for a frame are handled.
+func (s *Surface) OnEventsHandled(fn func()) { s.eventsHandled = fn }
+
 func (s *Surface) Loop(fn func()) {
 
 	defer s.cleanUp()
@@ -41,8 +68,24 @@ func (s *Surface) Loop(fn func()) {
 			case *sdl.QuitEvent:
 				running = false
 			case *sdl.KeyboardEvent:
-				if e.Keysym.Sym == sdl.K_ESCAPE {
-					running = false
+				if s.keyHandler != nil {
+					s.keyHandler(e)
+				}
+			case *sdl.TextInputEvent:
+				if s.textHandler != nil {
+					s.textHandler(e.GetText())
+				}
+			case *sdl.MouseButtonEvent:
+				if s.buttonHandler != nil {
+					s.buttonHandler(e)
+				}
+			case *sdl.MouseMotionEvent:
+				if s.motionHandler != nil {
+					s.motionHandler(e)
+				}
+			case *sdl.MouseWheelEvent:
+				if s.wheelHandler != nil {
+					s.wheelHandler(e)
 				}
 			case *sdl.WindowEvent:
 				if e.Event == sdl.WINDOWEVENT_RESIZED {
@@ -51,6 +94,9 @@ func (s *Surface) Loop(fn func()) {
 
 			}
 		}
+		if s.eventsHandled != nil {
+			s.eventsHandled()
+		}
 
 		s.drawBackground()
 		fn()
@@ -116,6 +162,8 @@ func (gs *Surface) init() {
 	gl.Viewport(0, 0, width, height)
 	diagnose()
 
+	sdl.StartTextInput()
+
 	gs.win = win
 	gs.gctx = ctx
 
@@ -3,6 +3,7 @@ package gfx
 import (
 	"fmt"
 	"runtime"
+	"unsafe"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 )
@@ -29,6 +30,14 @@ func diagnose() {
 		errCode, asGLErrorCode(errCode), file, line, fnName)
 }
 
+// ptr is gl.Ptr for buffer data that may be empty, gl.Ptr panics on those.
+func ptr[T any](data []T) unsafe.Pointer {
+	if len(data) == 0 {
+		return nil
+	}
+	return gl.Ptr(data)
+}
+
 func assert[T any](v T, e error) T {
 	if e != nil {
 		panic(e)
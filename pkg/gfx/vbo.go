@@ -15,12 +15,25 @@ func NewVBO(vertices []float32) *VBO {
 	diagnose()
 	gl.BindBuffer(gl.ARRAY_BUFFER, vbo.id)
 	diagnose()
-	gl.BufferData(gl.ARRAY_BUFFER, F32.SizeOf(len(vertices)), gl.Ptr(vertices), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, F32.SizeOf(len(vertices)), ptr(vertices), gl.DYNAMIC_DRAW)
 	diagnose()
 
 	return vbo
 }
 
+// Update uploads new vertices, the buffer is reallocated only when their count changes.
+func (v *VBO) Update(vertices []float32) {
+	v.Bind()
+	if len(vertices) == len(v.vertices) {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, F32.SizeOf(len(vertices)), ptr(vertices))
+	} else {
+		gl.BufferData(gl.ARRAY_BUFFER, F32.SizeOf(len(vertices)), ptr(vertices), gl.DYNAMIC_DRAW)
+	}
+	diagnose()
+	v.vertices = vertices
+	v.Unbind()
+}
+
 func (v *VBO) ID() uint32 {
 	return v.id
 }